@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+type Cache[V any] struct {
+	mu       sync.Mutex
+	size     int
+	ttl      time.Duration
+	ll       *list.List
+	items    map[string]*list.Element
+	inflight map[string]*call[V]
+	// bumped on every purge so in-flight loads don't store stale values
+	epoch uint64
+
+	hits      uint64
+	misses    uint64
+	loads     uint64
+	evictions uint64
+}
+
+type Stats struct {
+	Hits      uint64
+	Misses    uint64
+	Loads     uint64
+	Evictions uint64
+	Size      int
+	Capacity  int
+}
+
+type entry[V any] struct {
+	key   string
+	value V
+	exp   time.Time
+}
+
+type call[V any] struct {
+	wg  sync.WaitGroup
+	val V
+	err error
+}
+
+func New[V any](size int, ttl time.Duration) *Cache[V] {
+	return &Cache[V]{
+		size:     size,
+		ttl:      ttl,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+		inflight: make(map[string]*call[V]),
+	}
+}
+
+// GetOrLoad returns the cached value for key or runs load once for all
+// concurrent callers that miss on the same key.
+func (c *Cache[V]) GetOrLoad(key string, load func() (V, error)) (V, error) {
+	c.mu.Lock()
+	if v, ok := c.get(key); ok {
+		c.hits++
+		c.mu.Unlock()
+		return v, nil
+	}
+	c.misses++
+	if cl, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		cl.wg.Wait()
+		return cl.val, cl.err
+	}
+	cl := &call[V]{}
+	cl.wg.Add(1)
+	c.inflight[key] = cl
+	epoch := c.epoch
+	c.loads++
+	c.mu.Unlock()
+
+	completed := false
+	defer func() {
+		c.mu.Lock()
+		delete(c.inflight, key)
+		if completed && cl.err == nil && epoch == c.epoch {
+			c.set(key, cl.val)
+		}
+		c.mu.Unlock()
+		// waiters must not block forever if load panics
+		if !completed {
+			cl.err = errors.New("cache: load panicked")
+		}
+		cl.wg.Done()
+	}()
+
+	cl.val, cl.err = load()
+	completed = true
+
+	return cl.val, cl.err
+}
+
+// Purge drops every entry and returns how many there were. Loads already in
+// flight finish but don't store their result.
+func (c *Cache[V]) Purge() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := c.ll.Len()
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+	c.epoch++
+	return n
+}
+
+func (c *Cache[V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Loads:     c.loads,
+		Evictions: c.evictions,
+		Size:      c.ll.Len(),
+		Capacity:  c.size,
+	}
+}
+
+func (c *Cache[V]) get(key string) (V, bool) {
+	var zero V
+	el, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	e := el.Value.(*entry[V])
+	if c.ttl > 0 && time.Now().After(e.exp) {
+		c.ll.Remove(el)
+		delete(c.items, key)
+		c.evictions++
+		return zero, false
+	}
+	c.ll.MoveToFront(el)
+	return e.value, true
+}
+
+func (c *Cache[V]) set(key string, value V) {
+	exp := time.Now().Add(c.ttl)
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[V])
+		e.value = value
+		e.exp = exp
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&entry[V]{key: key, value: value, exp: exp})
+	for c.size > 0 && c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry[V]).key)
+		c.evictions++
+	}
+}
@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func constLoad(v int, calls *int32) func() (int, error) {
+	return func() (int, error) {
+		atomic.AddInt32(calls, 1)
+		return v, nil
+	}
+}
+
+func TestGetOrLoadCaches(t *testing.T) {
+	c := New[int](10, time.Hour)
+	var calls int32
+	for i := 0; i < 3; i++ {
+		v, err := c.GetOrLoad("a", constLoad(1, &calls))
+		if err != nil || v != 1 {
+			t.Fatalf("GetOrLoad = %d, %v, want 1", v, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("load ran %d times, want 1", calls)
+	}
+	st := c.Stats()
+	if st.Hits != 2 || st.Misses != 1 || st.Loads != 1 || st.Size != 1 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestGetOrLoadErrorNotCached(t *testing.T) {
+	c := New[int](10, time.Hour)
+	if _, err := c.GetOrLoad("a", func() (int, error) { return 0, errors.New("boom") }); err == nil {
+		t.Fatal("expected the load error")
+	}
+	var calls int32
+	if v, err := c.GetOrLoad("a", constLoad(2, &calls)); err != nil || v != 2 || calls != 1 {
+		t.Errorf("GetOrLoad after error = %d, %v with %d loads", v, err, calls)
+	}
+}
+
+func TestGetOrLoadSharesConcurrentLoads(t *testing.T) {
+	c := New[int](10, time.Hour)
+	var calls int32
+	release := make(chan struct{})
+	load := func() (int, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return 7, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]int, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = c.GetOrLoad("a", load)
+		}(i)
+	}
+	// let every caller reach the in-flight load before it finishes
+	for c.Stats().Misses < uint64(len(results)) {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("load ran %d times, want 1", calls)
+	}
+	for i, v := range results {
+		if v != 7 {
+			t.Errorf("caller %d got %d, want 7", i, v)
+		}
+	}
+}
+
+func TestEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[int](2, time.Hour)
+	var calls int32
+	c.GetOrLoad("a", constLoad(1, &calls))
+	c.GetOrLoad("b", constLoad(2, &calls))
+	c.GetOrLoad("a", constLoad(1, &calls)) // a is now the most recent
+	c.GetOrLoad("c", constLoad(3, &calls)) // evicts b
+
+	calls = 0
+	c.GetOrLoad("a", constLoad(1, &calls))
+	if calls != 0 {
+		t.Error("a was evicted, want b evicted")
+	}
+	c.GetOrLoad("b", constLoad(2, &calls))
+	if calls != 1 {
+		t.Error("b was still cached")
+	}
+	if st := c.Stats(); st.Size != 2 || st.Evictions != 2 {
+		t.Errorf("stats = %+v, want size 2 and 2 evictions", st)
+	}
+}
+
+func TestExpiresAfterTTL(t *testing.T) {
+	c := New[int](10, time.Millisecond)
+	var calls int32
+	c.GetOrLoad("a", constLoad(1, &calls))
+	time.Sleep(5 * time.Millisecond)
+	c.GetOrLoad("a", constLoad(1, &calls))
+	if calls != 2 {
+		t.Errorf("load ran %d times, want 2 after expiry", calls)
+	}
+}
+
+func TestPurgeDropsEntriesAndInflightResults(t *testing.T) {
+	c := New[int](10, time.Hour)
+	var calls int32
+	c.GetOrLoad("a", constLoad(1, &calls))
+	c.GetOrLoad("b", constLoad(2, &calls))
+
+	// a load that started before the purge must not store its stale value
+	c.GetOrLoad("c", func() (int, error) {
+		if n := c.Purge(); n != 2 {
+			t.Errorf("Purge = %d, want 2", n)
+		}
+		return 3, nil
+	})
+	if st := c.Stats(); st.Size != 0 {
+		t.Errorf("size after purge = %d, want 0", st.Size)
+	}
+}
+
+func TestPanickingLoadReleasesWaiters(t *testing.T) {
+	c := New[int](10, time.Hour)
+	func() {
+		defer func() { recover() }()
+		c.GetOrLoad("a", func() (int, error) { panic("boom") })
+	}()
+
+	var calls int32
+	if v, err := c.GetOrLoad("a", constLoad(1, &calls)); err != nil || v != 1 {
+		t.Errorf("GetOrLoad after panic = %d, %v, want 1", v, err)
+	}
+}
@@ -0,0 +1,375 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/antonite/ltd-meta-server/util"
+)
+
+type Config struct {
+	Database  Database
+	API       API
+	Server    Server
+	Guides    Guides
+	Tiers     Tiers
+	Generator Generator
+}
+
+type Database struct {
+	User     string
+	Password string
+	Host     string
+	Port     int
+	Name     string
+}
+
+type API struct {
+	Key string
+}
+
+type Server struct {
+	Addr                 string
+	Mode                 string
+	CertPath             string
+	KeyPath              string
+	CertReload           bool
+	AllowedOrigins       []string
+	TrustedProxies       []string
+	AdminToken           string
+	IngestionPollMinutes int
+	CacheHours           int
+	CacheSize            int
+}
+
+type Guides struct {
+	MaxGuides       int
+	HoldsPerWave    int
+	LeakScaler      float64
+	MastermindRules string
+	Filters         string
+	// chain guide waves along transitions players were seen making
+	ObservedPaths      bool
+	MinTransitionGames int
+}
+
+// Tiers weighs the stats combined into a tier list score
+type Tiers struct {
+	WinrateWeight  float64
+	PickRateWeight float64
+	HoldRateWeight float64
+	ValueWeight    float64
+	MinGames       int
+	// inclusive wave ranges like 1-3, one tier list is built per range
+	WaveRanges []string
+}
+
+type Generator struct {
+	Workers     int
+	MinElo      int
+	MetricsFile string
+	// keep per player summaries, off by default as it writes a row per
+	// player, wave and board
+	Players bool
+}
+
+func Default() *Config {
+	return &Config{
+		Database: Database{
+			User: "antonite",
+			Host: "127.0.0.1",
+			Port: 3306,
+			Name: "ltd",
+		},
+		Server: Server{
+			Addr:                 ":8081",
+			Mode:                 "tls",
+			AllowedOrigins:       []string{"*"},
+			IngestionPollMinutes: 5,
+			CacheHours:           24,
+			CacheSize:            2048,
+		},
+		Guides: Guides{
+			MaxGuides:    102,
+			HoldsPerWave: 500,
+			LeakScaler:   3,
+
+			MinTransitionGames: 3,
+		},
+		Tiers: Tiers{
+			WinrateWeight:  0.4,
+			PickRateWeight: 0.2,
+			HoldRateWeight: 0.25,
+			ValueWeight:    0.15,
+			MinGames:       50,
+			WaveRanges:     []string{"1-3", "4-6", "7-8"},
+		},
+		Generator: Generator{
+			Workers: 20,
+			MinElo:  2600,
+		},
+	}
+}
+
+// field ties one setting to its key in the config file, its env var and its
+// flag, so all three sources stay in sync
+type field struct {
+	key   string
+	env   string
+	usage string
+	ptr   interface{}
+}
+
+func (c *Config) fields() []field {
+	return []field{
+		{"database.user", "DB_USER", "database user", &c.Database.User},
+		{"database.password", "DB_PW", "database password", &c.Database.Password},
+		{"database.host", "DB_HOST", "database host", &c.Database.Host},
+		{"database.port", "DB_PORT", "database port", &c.Database.Port},
+		{"database.name", "DB_NAME", "database name", &c.Database.Name},
+		{"api.key", "apikey", "LTD2 api key", &c.API.Key},
+		{"server.addr", "listen_addr", "address to listen on", &c.Server.Addr},
+		{"server.mode", "listen_mode", "tls or http", &c.Server.Mode},
+		{"server.cert_path", "cert_path", "TLS certificate path", &c.Server.CertPath},
+		{"server.key_path", "key_path", "TLS key path", &c.Server.KeyPath},
+		{"server.cert_reload", "cert_reload", "reload the certificate when it changes on disk", &c.Server.CertReload},
+		{"server.allowed_origins", "allowed_origins", "comma separated CORS origins", &c.Server.AllowedOrigins},
+		{"server.trusted_proxies", "trusted_proxies", "comma separated proxy IPs or CIDRs whose forwarded headers are trusted", &c.Server.TrustedProxies},
+		{"server.admin_token", "admin_token", "bearer token for the admin endpoints", &c.Server.AdminToken},
+		{"server.ingestion_poll_minutes", "ingestion_poll_minutes", "minutes between ingestion run checks", &c.Server.IngestionPollMinutes},
+		{"server.cache_hours", "cache_hours", "hours holds stay cached", &c.Server.CacheHours},
+		{"server.cache_size", "cache_size", "holds cache entries", &c.Server.CacheSize},
+		{"guides.max_guides", "max_guides", "guides to keep per legion in a generation", &c.Guides.MaxGuides},
+		{"guides.holds_per_wave", "guide_holds_per_wave", "holds considered per wave", &c.Guides.HoldsPerWave},
+		{"guides.leak_scaler", "guide_leak_scaler", "leak penalty used when scoring guide holds", &c.Guides.LeakScaler},
+		{"guides.mastermind_rules", "mastermind_rules", "mastermind rules file, empty for the built in rules", &c.Guides.MastermindRules},
+		{"guides.filters", "guide_filters", "guide filters file, empty for the built in filters", &c.Guides.Filters},
+		{"guides.observed_paths", "guide_observed_paths", "build guides from observed hold transitions instead of matching positions", &c.Guides.ObservedPaths},
+		{"guides.min_transition_games", "guide_min_transition_games", "games a transition needs before guides follow it", &c.Guides.MinTransitionGames},
+		{"tiers.winrate_weight", "tier_winrate_weight", "weight of winrate in tier scores", &c.Tiers.WinrateWeight},
+		{"tiers.pick_rate_weight", "tier_pick_rate_weight", "weight of pick rate in tier scores", &c.Tiers.PickRateWeight},
+		{"tiers.hold_rate_weight", "tier_hold_rate_weight", "weight of hold rate in tier scores", &c.Tiers.HoldRateWeight},
+		{"tiers.value_weight", "tier_value_weight", "weight of value efficiency in tier scores", &c.Tiers.ValueWeight},
+		{"tiers.min_games", "tier_min_games", "games a unit needs in a wave range to be tiered", &c.Tiers.MinGames},
+		{"tiers.wave_ranges", "tier_wave_ranges", "comma separated wave ranges to build tier lists for, like 1-3", &c.Tiers.WaveRanges},
+		{"generator.workers", "generator_workers", "concurrent api workers", &c.Generator.Workers},
+		{"generator.min_elo", "generator_min_elo", "minimum elo for a new hold", &c.Generator.MinElo},
+		{"generator.metrics_file", "metrics_file", "textfile the generator writes metrics to", &c.Generator.MetricsFile},
+		{"generator.players", "generator_players", "store per player game summaries", &c.Generator.Players},
+	}
+}
+
+func (f field) set(raw string) error {
+	switch p := f.ptr.(type) {
+	case *string:
+		*p = raw
+	case *int:
+		v, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("%s: %q is not an integer", f.key, raw)
+		}
+		*p = v
+	case *float64:
+		v, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a number", f.key, raw)
+		}
+		*p = v
+	case *bool:
+		v, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a boolean", f.key, raw)
+		}
+		*p = v
+	case *[]string:
+		list := []string{}
+		for _, v := range strings.Split(raw, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				list = append(list, v)
+			}
+		}
+		*p = list
+	default:
+		return fmt.Errorf("%s: unsupported type %T", f.key, f.ptr)
+	}
+	return nil
+}
+
+func (f field) setValue(v value) error {
+	if p, ok := f.ptr.(*[]string); ok {
+		if !v.isList {
+			return fmt.Errorf("%s: expected a list", f.key)
+		}
+		*p = v.list
+		return nil
+	}
+	if v.isList {
+		return fmt.Errorf("%s: did not expect a list", f.key)
+	}
+	if _, ok := f.ptr.(*string); !ok && v.quoted {
+		return fmt.Errorf("%s: did not expect a string", f.key)
+	}
+	return f.set(v.raw)
+}
+
+// Load builds the config from defaults, then the config file, then env vars
+// and finally flags, each overriding the one before. The file is taken from
+// -config or the config_path env var. Positional args are returned.
+func Load(name string, args []string) (*Config, []string, error) {
+	c := Default()
+	fields := c.fields()
+
+	type pending struct {
+		f   field
+		raw string
+	}
+	flags := []pending{}
+	path := os.Getenv("config_path")
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&path, "config", path, "path to a TOML config file")
+	for _, f := range fields {
+		f := f
+		fs.Func(f.key, f.usage+" (env "+f.env+")", func(raw string) error {
+			flags = append(flags, pending{f: f, raw: raw})
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if path != "" {
+		values, err := parseFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		known := make(map[string]field, len(fields))
+		for _, f := range fields {
+			known[f.key] = f
+		}
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, k int) bool {
+			return values[keys[i]].line < values[keys[k]].line
+		})
+		for _, k := range keys {
+			v := values[k]
+			f, ok := known[k]
+			if !ok {
+				return nil, nil, fmt.Errorf("%s:%d: unknown setting %s", path, v.line, k)
+			}
+			if err := f.setValue(v); err != nil {
+				return nil, nil, fmt.Errorf("%s:%d: %v", path, v.line, err)
+			}
+		}
+	}
+
+	for _, f := range fields {
+		raw, ok := os.LookupEnv(f.env)
+		if !ok || raw == "" {
+			continue
+		}
+		if err := f.set(raw); err != nil {
+			return nil, nil, fmt.Errorf("env %s: %v", f.env, err)
+		}
+	}
+
+	for _, p := range flags {
+		if err := p.f.set(p.raw); err != nil {
+			return nil, nil, fmt.Errorf("flag -%v", err)
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	return c, fs.Args(), nil
+}
+
+func (c *Config) Validate() error {
+	errs := []string{}
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Database.User != "", "database.user must be set")
+	check(c.Database.Host != "", "database.host must be set")
+	check(c.Database.Name != "", "database.name must be set")
+	check(c.Database.Port > 0 && c.Database.Port < 65536, "database.port must be between 1 and 65535, got %d", c.Database.Port)
+	check(c.Guides.MaxGuides > 0, "guides.max_guides must be positive, got %d", c.Guides.MaxGuides)
+	check(c.Guides.HoldsPerWave > 0, "guides.holds_per_wave must be positive, got %d", c.Guides.HoldsPerWave)
+	check(c.Guides.MinTransitionGames > 0, "guides.min_transition_games must be positive, got %d", c.Guides.MinTransitionGames)
+	check(c.Guides.LeakScaler >= 0, "guides.leak_scaler must not be negative, got %v", c.Guides.LeakScaler)
+	check(c.Tiers.WinrateWeight >= 0 && c.Tiers.PickRateWeight >= 0 && c.Tiers.HoldRateWeight >= 0 && c.Tiers.ValueWeight >= 0, "tiers weights must not be negative")
+	check(c.Tiers.WinrateWeight+c.Tiers.PickRateWeight+c.Tiers.HoldRateWeight+c.Tiers.ValueWeight > 0, "tiers weights must not all be zero")
+	check(c.Tiers.MinGames > 0, "tiers.min_games must be positive, got %d", c.Tiers.MinGames)
+	for _, r := range c.Tiers.WaveRanges {
+		_, _, err := ParseWaveRange(r)
+		check(err == nil, "tiers.wave_ranges: %v", err)
+	}
+	check(c.Generator.Workers > 0, "generator.workers must be positive, got %d", c.Generator.Workers)
+	check(c.Generator.MinElo >= 0, "generator.min_elo must not be negative, got %d", c.Generator.MinElo)
+
+	if len(errs) > 0 {
+		return errors.New("invalid config: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Validate checks the settings only the api server needs, the generator
+// doesn't listen so it never calls this.
+func (s Server) Validate() error {
+	errs := []string{}
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(s.Addr != "", "server.addr must be set")
+	check(s.Mode == "tls" || s.Mode == "http", "server.mode must be tls or http, got %q", s.Mode)
+	if s.Mode == "tls" {
+		check(s.CertPath != "", "server.cert_path must be set in tls mode")
+		check(s.KeyPath != "", "server.key_path must be set in tls mode")
+	}
+	check(s.IngestionPollMinutes > 0, "server.ingestion_poll_minutes must be positive, got %d", s.IngestionPollMinutes)
+	check(s.CacheHours > 0, "server.cache_hours must be positive, got %d", s.CacheHours)
+	check(s.CacheSize > 0, "server.cache_size must be positive, got %d", s.CacheSize)
+
+	if len(errs) > 0 {
+		return errors.New("invalid server config: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// ParseWaveRange parses an inclusive range like 1-3, a single wave is also
+// accepted
+func ParseWaveRange(r string) (int, int, error) {
+	parts := strings.SplitN(r, "-", 2)
+	from, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid wave range %q", r)
+	}
+	to := from
+	if len(parts) == 2 {
+		to, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid wave range %q", r)
+		}
+	}
+	if from < 1 || to < from || to > util.Waves {
+		return 0, 0, fmt.Errorf("wave range %q must be within 1-%d", r, util.Waves)
+	}
+	return from, to, nil
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// clearEnv unsets every env var Load reads so the host environment can't
+// leak into a test
+func clearEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("config_path", "")
+	for _, f := range Default().fields() {
+		t.Setenv(f.env, "")
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfig(t, `[database]
+user = "file"
+host = "file-host"
+port = 3307
+
+[guides]
+leak_scaler = 2.5
+`)
+
+	tests := []struct {
+		name  string
+		file  bool
+		env   map[string]string
+		args  []string
+		check func(t *testing.T, c *Config)
+	}{
+		{
+			name: "defaults",
+			check: func(t *testing.T, c *Config) {
+				if !reflect.DeepEqual(c, Default()) {
+					t.Errorf("config = %+v, want the defaults", c)
+				}
+			},
+		},
+		{
+			name: "file overrides defaults",
+			file: true,
+			check: func(t *testing.T, c *Config) {
+				if c.Database.User != "file" || c.Database.Port != 3307 || c.Guides.LeakScaler != 2.5 {
+					t.Errorf("file values not applied: %+v %+v", c.Database, c.Guides)
+				}
+				if c.Database.Name != "ltd" {
+					t.Errorf("database.name = %q, want the default", c.Database.Name)
+				}
+			},
+		},
+		{
+			name: "env overrides file",
+			file: true,
+			env:  map[string]string{"DB_USER": "env", "DB_PORT": "3308"},
+			check: func(t *testing.T, c *Config) {
+				if c.Database.User != "env" || c.Database.Port != 3308 {
+					t.Errorf("env values not applied: %+v", c.Database)
+				}
+				if c.Database.Host != "file-host" {
+					t.Errorf("database.host = %q, want the file value", c.Database.Host)
+				}
+			},
+		},
+		{
+			name: "flags override env",
+			file: true,
+			env:  map[string]string{"DB_USER": "env", "DB_PORT": "3308"},
+			args: []string{"-database.user", "flag"},
+			check: func(t *testing.T, c *Config) {
+				if c.Database.User != "flag" {
+					t.Errorf("database.user = %q, want the flag value", c.Database.User)
+				}
+				if c.Database.Port != 3308 {
+					t.Errorf("database.port = %d, want the env value", c.Database.Port)
+				}
+			},
+		},
+		{
+			name: "config path from env",
+			env:  map[string]string{"config_path": path},
+			check: func(t *testing.T, c *Config) {
+				if c.Database.User != "file" {
+					t.Errorf("database.user = %q, want the file value", c.Database.User)
+				}
+			},
+		},
+		{
+			name: "list flags split on commas",
+			args: []string{"-server.allowed_origins", "a, b,,c"},
+			check: func(t *testing.T, c *Config) {
+				if want := []string{"a", "b", "c"}; !reflect.DeepEqual(c.Server.AllowedOrigins, want) {
+					t.Errorf("allowed_origins = %q, want %q", c.Server.AllowedOrigins, want)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			args := []string{}
+			if tt.file {
+				args = append(args, "-config", path)
+			}
+			c, rest, err := Load("test", append(args, tt.args...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rest) != 0 {
+				t.Errorf("positional args = %q, want none", rest)
+			}
+			tt.check(t, c)
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		env     map[string]string
+		args    []string
+		wantErr string
+	}{
+		{name: "unknown setting", content: "[database]\nusr = \"x\"\n", wantErr: ":2: unknown setting database.usr"},
+		{name: "quoted number", content: "[database]\nport = \"3306\"\n", wantErr: "did not expect a string"},
+		{name: "list for a string", content: "[database]\nuser = [\"a\"]\n", wantErr: "did not expect a list"},
+		{name: "string for a list", content: "[server]\nallowed_origins = \"a\"\n", wantErr: "expected a list"},
+		{name: "bad env", env: map[string]string{"DB_PORT": "abc"}, wantErr: "env DB_PORT"},
+		{name: "bad flag", args: []string{"-generator.players", "maybe"}, wantErr: "not a boolean"},
+		{name: "invalid config", args: []string{"-guides.max_guides", "0"}, wantErr: "guides.max_guides must be positive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			args := tt.args
+			if tt.content != "" {
+				args = append([]string{"-config", writeConfig(t, tt.content)}, args...)
+			}
+			_, _, err := Load("test", args)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// value is a single setting from the config file. Only the subset of TOML we
+// need is supported: [tables], key = value pairs, quoted strings, bare
+// numbers and booleans, single line arrays of strings and # comments.
+type value struct {
+	raw    string
+	quoted bool
+	list   []string
+	isList bool
+	line   int
+}
+
+func parseFile(path string) (map[string]value, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]value)
+	table := ""
+	scanner := bufio.NewScanner(f)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("%s:%d: unterminated table header", path, n)
+			}
+			table = strings.TrimSpace(line[1 : len(line)-1])
+			if table == "" {
+				return nil, fmt.Errorf("%s:%d: empty table name", path, n)
+			}
+			continue
+		}
+
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("%s:%d: expected key = value", path, n)
+		}
+		key := strings.TrimSpace(line[:eq])
+		if key == "" {
+			return nil, fmt.Errorf("%s:%d: missing key", path, n)
+		}
+		if table != "" {
+			key = table + "." + key
+		}
+		if _, ok := values[key]; ok {
+			return nil, fmt.Errorf("%s:%d: duplicate key %s", path, n, key)
+		}
+
+		v, err := parseValue(strings.TrimSpace(line[eq+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		v.line = n
+		values[key] = v
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+func parseValue(s string) (value, error) {
+	switch {
+	case s == "":
+		return value{}, fmt.Errorf("missing value")
+	case strings.HasPrefix(s, "["):
+		if !strings.HasSuffix(s, "]") {
+			return value{}, fmt.Errorf("arrays must be on a single line")
+		}
+		list := []string{}
+		for _, item := range splitArray(s[1 : len(s)-1]) {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			str, err := strconv.Unquote(item)
+			if err != nil {
+				return value{}, fmt.Errorf("array items must be quoted strings, got %s", item)
+			}
+			list = append(list, str)
+		}
+		return value{list: list, isList: true}, nil
+	case strings.HasPrefix(s, `"`):
+		str, err := strconv.Unquote(s)
+		if err != nil {
+			return value{}, fmt.Errorf("invalid string %s", s)
+		}
+		return value{raw: str, quoted: true}, nil
+	}
+	return value{raw: s}, nil
+}
+
+// split on commas outside of quotes
+func splitArray(s string) []string {
+	items := []string{}
+	inQuote := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			inQuote = !inQuote
+		case ',':
+			if !inQuote {
+				items = append(items, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(items, s[start:])
+}
+
+func stripComment(line string) string {
+	inQuote := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			inQuote = !inQuote
+		case '#':
+			if !inQuote {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
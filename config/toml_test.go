@@ -0,0 +1,144 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestStripComment(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"", ""},
+		{"# only a comment", ""},
+		{"key = 1 # trailing", "key = 1 "},
+		{`key = "a # b"`, `key = "a # b"`},
+		{`key = "a \" # b" # c`, `key = "a \" # b" `},
+		{`key = ["#", "b"] # c`, `key = ["#", "b"] `},
+	}
+	for _, tt := range tests {
+		if got := stripComment(tt.line); got != tt.want {
+			t.Errorf("stripComment(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestSplitArray(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", []string{""}},
+		{`"a"`, []string{`"a"`}},
+		{`"a", "b"`, []string{`"a"`, ` "b"`}},
+		{`"a,b", "c"`, []string{`"a,b"`, ` "c"`}},
+		{`"a\",b", "c"`, []string{`"a\",b"`, ` "c"`}},
+		{`"a",`, []string{`"a"`, ""}},
+	}
+	for _, tt := range tests {
+		if got := splitArray(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitArray(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    value
+		wantErr string
+	}{
+		{in: "42", want: value{raw: "42"}},
+		{in: "true", want: value{raw: "true"}},
+		{in: "0.5", want: value{raw: "0.5"}},
+		{in: `"hello"`, want: value{raw: "hello", quoted: true}},
+		{in: `"a \"b\""`, want: value{raw: `a "b"`, quoted: true}},
+		{in: `""`, want: value{raw: "", quoted: true}},
+		{in: `[]`, want: value{list: []string{}, isList: true}},
+		{in: `["a", "b,c"]`, want: value{list: []string{"a", "b,c"}, isList: true}},
+		{in: `["a", ]`, want: value{list: []string{"a"}, isList: true}},
+		{in: "", wantErr: "missing value"},
+		{in: `["a"`, wantErr: "single line"},
+		{in: `[a]`, wantErr: "quoted strings"},
+		{in: `"open`, wantErr: "invalid string"},
+	}
+	for _, tt := range tests {
+		got, err := parseValue(tt.in)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseValue(%q) error = %v, want %q", tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseValue(%q) unexpected error: %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseValue(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	path := writeConfig(t, `# top comment
+root = 1
+
+[database]
+user = "me" # comment
+port = 3307
+
+[ server ]
+allowed_origins = ["a", "b"]
+`)
+	values, err := parseFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]value{
+		"root":                   {raw: "1", line: 2},
+		"database.user":          {raw: "me", quoted: true, line: 5},
+		"database.port":          {raw: "3307", line: 6},
+		"server.allowed_origins": {list: []string{"a", "b"}, isList: true, line: 9},
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("parseFile = %+v, want %+v", values, want)
+	}
+}
+
+func TestParseFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"unterminated table", "[database\n", ":1: unterminated table header"},
+		{"empty table", "[ ]\n", ":1: empty table name"},
+		{"no equals", "\nkey\n", ":2: expected key = value"},
+		{"missing key", "= 1\n", ":1: missing key"},
+		{"missing value", "key =\n", ":1: missing value"},
+		{"duplicate key", "[a]\nkey = 1\nkey = 2\n", ":3: duplicate key a.key"},
+		{"multiline array", "key = [\n\"a\"]\n", ":1: arrays must be on a single line"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseFile(writeConfig(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -3,24 +3,35 @@ package db
 import (
 	"database/sql"
 	"fmt"
-	"os"
 
+	"github.com/antonite/ltd-meta-server/config"
 	_ "github.com/go-sql-driver/mysql"
 )
 
-const holdsQuery = "create table if not exists %s(id int not null auto_increment,position_hash varchar(2048) not null,position varchar(2048) not null,total_value int not null,version_added varchar(16) not null,won int not null,lost int not null,workers int not null, player varchar(64) not null, primary key(id),index version_index (version_added));"
+const holdsQuery = "create table if not exists %s(id int not null auto_increment,position_hash varchar(2048) not null,hold_hash char(16) not null default '',position varchar(2048) not null,total_value int not null,version_added varchar(16) not null,won int not null,lost int not null,workers int not null, elo bigint not null default 0, elo_games int not null default 0, player varchar(64) not null, primary key(id),index version_index (version_added),index hold_hash_index (hold_hash));"
 const sendsQuery = "create table if not exists %s(id int not null auto_increment,holds_id int not null,sends varchar(1024) not null,held int not null,leaked int not null,leaked_amount int not null,primary key(id),foreign key(holds_id) references %s(id) ON UPDATE CASCADE ON DELETE CASCADE);"
 const allTables = "show tables like '%_holds';"
+const columnExistsQuery = "select count(*) from information_schema.columns where table_schema = database() and table_name = ? and column_name = ?"
+const addHoldsEloQuery = "alter table %s add column elo int not null default 0 after workers;"
+const addHoldsEloGamesQuery = "alter table %s modify elo bigint not null default 0, add column elo_games int not null default 0 after elo;"
 
-const deleteOldVersionData = "delete from %s where version_added != '%s'"
+// the elo summed so far covers an unknown share of each hold's games, start
+// the average over rather than dilute it with games that had no elo
+const resetHoldsEloQuery = "update %s set elo = 0;"
+const addHoldHashQuery = "alter table %s add column hold_hash char(16) not null default '' after position_hash, add index hold_hash_index (hold_hash);"
+
+// hold ids use the first 16 hex chars of the position hash's sha1
+const backfillHoldHashQuery = "update %s set hold_hash = left(sha1(position_hash), 16) where hold_hash = '';"
 
-const user = "antonite"
-const database = "ltd"
+// hold_hash is the last column UpgradeHoldsTable adds, a table that has it
+// has the others too
+const pendingUpgradesQuery = "select count(*) from information_schema.tables t where t.table_schema = database() and t.table_name like '%\\_holds' and not exists (select 1 from information_schema.columns c where c.table_schema = t.table_schema and c.table_name = t.table_name and c.column_name = 'hold_hash')"
 
-func New() (*sql.DB, error) {
-	pwd := os.Getenv("DB_PW")
-	host := os.Getenv("DB_HOST")
-	connstring := fmt.Sprintf("%s:%s@tcp(%s:3306)/%s", user, pwd, host, database)
+const deleteOldVersionData = "delete from %s where version_added != '%s'"
+const deleteOldVersionRows = "delete from %s where version != ?"
+
+func New(cfg config.Database) (*sql.DB, error) {
+	connstring := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true", cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.Name)
 	db, err := sql.Open("mysql", connstring)
 	if err != nil {
 		return nil, err
@@ -68,12 +79,51 @@ func CreateTable(db *sql.DB, name string) error {
 		return err
 	}
 
-	err = tx.Commit()
+	return tx.Commit()
+}
+
+// UpgradeHoldsTable brings a holds table created by an older release up to
+// the current columns. Tables from CreateTable already have them. Adding
+// hold_hash rewrites the whole table, so this runs once at deploy rather
+// than as part of ingestion. It reports whether the table had to change.
+func UpgradeHoldsTable(db *sql.DB, holdsName string) (bool, error) {
+	// tables created before elo tracking need the column added
+	addedElo, err := addColumnIfMissing(db, holdsName, "elo", fmt.Sprintf(addHoldsEloQuery, holdsName))
 	if err != nil {
-		return err
+		return addedElo, err
 	}
+	addedGames, err := addColumnIfMissing(db, holdsName, "elo_games", fmt.Sprintf(addHoldsEloGamesQuery, holdsName), fmt.Sprintf(resetHoldsEloQuery, holdsName))
+	if err != nil {
+		return true, err
+	}
+	// and tables from before stable hold ids need the hash filled in once
+	addedHash, err := addColumnIfMissing(db, holdsName, "hold_hash", fmt.Sprintf(addHoldHashQuery, holdsName), fmt.Sprintf(backfillHoldHashQuery, holdsName))
+	return addedElo || addedGames || addedHash, err
+}
 
-	return err
+// PendingUpgrades counts the holds tables UpgradeHoldsTable still has to run on
+func PendingUpgrades(db *sql.DB) (int, error) {
+	var count int
+	err := db.QueryRow(pendingUpgradesQuery).Scan(&count)
+	return count, err
+}
+
+// addColumnIfMissing runs the queries in order when the column doesn't exist
+// and reports whether it did
+func addColumnIfMissing(db *sql.DB, table, column string, queries ...string) (bool, error) {
+	var count int
+	if err := db.QueryRow(columnExistsQuery, table, column).Scan(&count); err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+	for _, q := range queries {
+		if _, err := db.Exec(q); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
 }
 
 func GetTables(db *sql.DB) (map[string]bool, error) {
@@ -99,6 +149,15 @@ func DeleteOldData(db *sql.DB, version, table string) error {
 	return err
 }
 
+// DeleteOldVersionRows prunes a global table keyed by a version column
+func DeleteOldVersionRows(db *sql.DB, version, table string) (int64, error) {
+	res, err := db.Exec(fmt.Sprintf(deleteOldVersionRows, table), version)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 func CloseRows(rows *sql.Rows) {
 	if rows != nil {
 		rows.Close()
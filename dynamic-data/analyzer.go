@@ -22,9 +22,14 @@ type Stats struct {
 	Winrate      int
 	VersionAdded string
 	Workers      float64
+	Games        int
 	Player       string
+	HoldID       string
 }
 
+// gold a player earns for clearing each wave
+var waveBounties = map[int]float64{1: 72, 2: 84, 3: 90, 4: 96, 5: 108, 6: 114, 7: 120, 8: 132}
+
 type analysis struct {
 	sends      []*Send
 	bestScore  float64
@@ -32,17 +37,8 @@ type analysis struct {
 	hold       *Hold
 }
 
-func GetTopHolds(db *sql.DB, primary string, secondary string, allMercs map[string]*mercenary.Mercenary, wave int, version string, max int, dedupe bool, leakScaler float64) ([]*Stats, error) {
-	bounties := make(map[int]float64)
-	bounties[1] = 72
-	bounties[2] = 84
-	bounties[3] = 90
-	bounties[4] = 96
-	bounties[5] = 108
-	bounties[6] = 114
-	bounties[7] = 120
-	bounties[8] = 132
-
+func GetTopHolds(db *sql.DB, primary string, secondary string, allMercs map[string]*mercenary.Mercenary, wave int, version string, max int, dedupe bool, leakScaler float64, minElo int) ([]*Stats, error) {
+	bounties := waveBounties
 	stats := []*Stats{}
 	tn := util.GenerateUnitTableName(primary, wave)
 	tns := tn + "_sends"
@@ -62,6 +58,9 @@ func GetTopHolds(db *sql.DB, primary string, secondary string, allMercs map[stri
 			if h.VersionAdded != version || (secondary != "Any" && !containsUnit(h.Position, secondary)) {
 				continue
 			}
+			if minElo > 0 && h.AverageElo() < minElo {
+				continue
+			}
 
 			analyses[s.HoldsID] = &analysis{hold: h, bestScore: -300}
 		}
@@ -127,6 +126,7 @@ func GetTopHolds(db *sql.DB, primary string, secondary string, allMercs map[stri
 			ID:      k,
 			Winrate: int(math.Floor((float64(v.hold.Won) / float64(v.totalGames)) * 100)),
 			Workers: math.Floor((float64(v.hold.Workers)/float64(v.totalGames))*10) / 10,
+			Games:   v.totalGames,
 		}
 		stats = append(stats, &stat)
 	}
@@ -157,6 +157,7 @@ func GetTopHolds(db *sql.DB, primary string, secondary string, allMercs map[stri
 		s.VersionAdded = h.VersionAdded
 		s.Hash = h.PositionHash
 		s.Player = h.Player
+		s.HoldID = NewHoldID(primary, wave, version, h.PositionHash).String()
 		if count >= max {
 			break
 		}
@@ -0,0 +1,30 @@
+package dynamicdata
+
+type Bracket struct {
+	Name   string
+	MinElo int
+}
+
+var Brackets = []Bracket{
+	{Name: "all", MinElo: 0},
+	{Name: "2600", MinElo: 2600},
+	{Name: "2800", MinElo: 2800},
+	{Name: "3000", MinElo: 3000},
+}
+
+func FindBracket(name string) (Bracket, bool) {
+	for _, b := range Brackets {
+		if b.Name == name {
+			return b, true
+		}
+	}
+	return Bracket{}, false
+}
+
+// AverageElo is 0 when no game of the hold has a known elo
+func (h *Hold) AverageElo() int {
+	if h.EloGames == 0 {
+		return 0
+	}
+	return int(h.Elo / int64(h.EloGames))
+}
@@ -0,0 +1,137 @@
+package dynamicdata
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/antonite/ltd-meta-server/mercenary"
+	"github.com/antonite/ltd-meta-server/util"
+)
+
+const counterSendsQuery = `SELECT h.id, h.position, s.sends, s.held, s.leaked, s.leaked_amount FROM %s s JOIN %s h ON s.holds_id = h.id WHERE h.version_added = ? AND h.total_value BETWEEN ? AND ?`
+
+// boards within this share of the requested value count as comparable
+const counterValueTolerance = 0.15
+
+type SendQuery struct {
+	Primary string
+	Wave    int
+	Version string
+	// board value, 0 matches any value
+	Value int
+	// optional board in the hold position format, narrows the match down to
+	// boards with the same units
+	Position string
+	Mythium  int
+	MinGames int
+	Limit    int
+}
+
+type SendRecommendation struct {
+	Sends        string
+	Mercenaries  []string
+	TotalMythium int
+	Boards       int
+	Games        int
+	Held         int
+	Leaked       int
+	LeakedAmount int
+	// percent of games the send leaked
+	LeakRate float64
+	// average gold leaked per game for each mythium spent
+	LeakedGoldPerMythium float64
+}
+
+func RecommendSends(db *sql.DB, sq SendQuery, allMercs map[string]*mercenary.Mercenary) ([]*SendRecommendation, error) {
+	tn := util.GenerateUnitTableName(sq.Primary, sq.Wave)
+	minValue, maxValue := 0, math.MaxInt32
+	if sq.Value > 0 {
+		minValue = int(math.Floor(float64(sq.Value) * (1 - counterValueTolerance)))
+		maxValue = int(math.Ceil(float64(sq.Value) * (1 + counterValueTolerance)))
+	}
+
+	rows, err := db.Query(fmt.Sprintf(counterSendsQuery, tn+"_sends", tn+"_holds"), sq.Version, minValue, maxValue)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	units := ""
+	if sq.Position != "" {
+		units = collapseUnits(sq.Position)
+	}
+
+	recs := make(map[string]*SendRecommendation)
+	boards := make(map[string]map[int]bool)
+	for rows.Next() {
+		var holdID int
+		var position string
+		var s Send
+		if err := rows.Scan(&holdID, &position, &s.Sends, &s.Held, &s.Leaked, &s.LeakedAmount); err != nil {
+			return nil, err
+		}
+		if s.Sends == "" {
+			continue
+		}
+		if units != "" && collapseUnits(position) != units {
+			continue
+		}
+
+		rec, ok := recs[s.Sends]
+		if !ok {
+			rec = &SendRecommendation{Sends: s.Sends, Mercenaries: strings.Split(s.Sends, ",")}
+			known := true
+			for _, m := range rec.Mercenaries {
+				merc, ok := allMercs[m]
+				if !ok {
+					known = false
+					break
+				}
+				rec.TotalMythium += merc.MythiumCost
+			}
+			// skip sends with mercs we no longer know the cost of
+			if !known {
+				rec.TotalMythium = math.MaxInt32
+			}
+			recs[s.Sends] = rec
+			boards[s.Sends] = make(map[int]bool)
+		}
+		rec.Held += s.Held
+		rec.Leaked += s.Leaked
+		rec.LeakedAmount += s.LeakedAmount
+		boards[s.Sends][holdID] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	out := []*SendRecommendation{}
+	for sends, rec := range recs {
+		rec.Games = rec.Held + rec.Leaked
+		if rec.TotalMythium > sq.Mythium || rec.TotalMythium == 0 || rec.Games < sq.MinGames || rec.Games == 0 {
+			continue
+		}
+		rec.Boards = len(boards[sends])
+		rec.LeakRate = util.Percent(rec.Leaked, rec.Games)
+		rec.LeakedGoldPerMythium = math.Round(float64(rec.LeakedAmount)/float64(rec.Games)/float64(rec.TotalMythium)*1000) / 1000
+		out = append(out, rec)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].LeakRate != out[j].LeakRate {
+			return out[i].LeakRate > out[j].LeakRate
+		}
+		if out[i].LeakedGoldPerMythium != out[j].LeakedGoldPerMythium {
+			return out[i].LeakedGoldPerMythium > out[j].LeakedGoldPerMythium
+		}
+		return out[i].TotalMythium < out[j].TotalMythium
+	})
+	if sq.Limit > 0 && len(out) > sq.Limit {
+		out = out[:sq.Limit]
+	}
+
+	return out, nil
+}
@@ -0,0 +1,135 @@
+package dynamicdata
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/antonite/ltd-meta-server/mercenary"
+)
+
+type HoldDetail struct {
+	ID           string
+	Unit         string
+	Wave         int
+	Version      string
+	Position     string
+	PositionHash string
+	TotalValue   int
+	Games        int
+	Won          int
+	Lost         int
+	Winrate      int
+	Workers      float64
+	AverageElo   int
+	// the first player seen with the board
+	Player string
+	// the players who built the board most, only kept when player summaries
+	// are enabled in the generator
+	Players []*HoldPlayer
+	Sends   []*SendDetail
+	// observed when players were seen making the transitions, otherwise
+	// inferred from positions
+	NextSource string
+	Next       []*Transition
+}
+
+type HoldPlayer struct {
+	Name     string
+	Games    int
+	Winrate  float64
+	HoldRate float64
+}
+
+type SendDetail struct {
+	Sends        string
+	TotalMythium int
+	Games        int
+	Held         int
+	Leaked       int
+	LeakedAmount int
+	// share of games this send leaked
+	LeakRate int
+	// share of the wave bounty lost when it leaked, as in Send.LeakedRatio
+	LeakedRatio int
+}
+
+type Transition struct {
+	ID         string
+	Unit       string
+	Position   string
+	TotalValue int
+	Games      int
+	Winrate    int
+	Workers    float64
+	// games where a player went from the hold to this one
+	Observed int
+}
+
+func GetHoldDetail(db *sql.DB, id HoldID, allMercs map[string]*mercenary.Mercenary) (*HoldDetail, error) {
+	h, err := FindHoldByStableID(db, id)
+	if err != nil || h == nil {
+		return nil, err
+	}
+
+	sends, err := GetHoldSends(db, id.TableName()+"_sends", h.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	games := h.Won + h.Lost
+	d := &HoldDetail{
+		ID:           id.String(),
+		Unit:         id.Unit,
+		Wave:         id.Wave,
+		Version:      h.VersionAdded,
+		Position:     h.Position,
+		PositionHash: h.PositionHash,
+		TotalValue:   h.TotalValue,
+		Games:        games,
+		Won:          h.Won,
+		Lost:         h.Lost,
+		AverageElo:   h.AverageElo(),
+		Player:       h.Player,
+		Players:      []*HoldPlayer{},
+		Sends:        []*SendDetail{},
+		Next:         []*Transition{},
+	}
+	if games > 0 {
+		d.Winrate = int(math.Floor(float64(h.Won) / float64(games) * 100))
+		d.Workers = math.Floor(float64(h.Workers)/float64(games)*10) / 10
+	}
+
+	for _, s := range sends {
+		sd := &SendDetail{
+			Sends:        s.Sends,
+			Games:        s.Held + s.Leaked,
+			Held:         s.Held,
+			Leaked:       s.Leaked,
+			LeakedAmount: s.LeakedAmount,
+		}
+		if s.Sends != "" {
+			for _, m := range strings.Split(s.Sends, ",") {
+				if merc, ok := allMercs[m]; ok {
+					sd.TotalMythium += merc.MythiumCost
+				}
+			}
+		}
+		if sd.Games > 0 {
+			sd.LeakRate = int(math.Floor(float64(s.Leaked) / float64(sd.Games) * 100))
+		}
+		if s.Leaked > 0 {
+			sd.LeakedRatio = int(math.Floor(float64(s.LeakedAmount) / float64(s.Leaked) / waveBounties[id.Wave] * 100))
+		}
+		d.Sends = append(d.Sends, sd)
+	}
+	sort.Slice(d.Sends, func(i, j int) bool {
+		if d.Sends[i].TotalMythium != d.Sends[j].TotalMythium {
+			return d.Sends[i].TotalMythium < d.Sends[j].TotalMythium
+		}
+		return d.Sends[i].Games > d.Sends[j].Games
+	})
+
+	return d, nil
+}
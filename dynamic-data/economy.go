@@ -0,0 +1,110 @@
+package dynamicdata
+
+import (
+	"database/sql"
+	"sort"
+
+	"github.com/antonite/ltd-meta-server/util"
+)
+
+const upsertEconomyQuery = `INSERT INTO hold_economy(version, unit, wave, position_hash, workers, value_bucket, games, won, held) VALUES(?,?,?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE games = games + VALUES(games), won = won + VALUES(won), held = held + VALUES(held)`
+const getEconomyQuery = `SELECT version, unit, wave, position_hash, workers, value_bucket, games, won, held FROM hold_economy where version = ? and unit = ? and wave = ? and position_hash = ?`
+
+// ValueBucketSize groups board values so the economy rows stay small
+const ValueBucketSize = 50
+
+// HoldEconomy counts the games a hold was played with a given worker count
+// and board value, and how they turned out
+type HoldEconomy struct {
+	Version      string
+	Unit         string
+	Wave         int
+	PositionHash string
+	Workers      int
+	ValueBucket  int
+	Games        int
+	Won          int
+	Held         int
+}
+
+func ValueBucket(value int) int {
+	return value / ValueBucketSize * ValueBucketSize
+}
+
+func (e *HoldEconomy) Upsert(db *sql.DB) error {
+	_, err := db.Exec(upsertEconomyQuery, e.Version, e.Unit, e.Wave, e.PositionHash, e.Workers, e.ValueBucket, e.Games, e.Won, e.Held)
+	return err
+}
+
+type EconomyBucket struct {
+	// worker count or the lower bound of the value bucket
+	Bucket   int
+	Games    int
+	Won      int
+	Held     int
+	Winrate  float64
+	Holdrate float64
+}
+
+// EconomySummary is the worker and value distribution of a hold with the
+// outcome for each bucket
+type EconomySummary struct {
+	ID              string
+	Games           int
+	ValueBucketSize int
+	Workers         []*EconomyBucket
+	Value           []*EconomyBucket
+}
+
+func GetHoldEconomy(db *sql.DB, id HoldID) (*EconomySummary, error) {
+	rows, err := db.Query(getEconomyQuery, id.Version, id.Unit, id.Wave, id.Hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workers := make(map[int]*EconomyBucket)
+	values := make(map[int]*EconomyBucket)
+	out := &EconomySummary{ID: id.String(), ValueBucketSize: ValueBucketSize, Workers: []*EconomyBucket{}, Value: []*EconomyBucket{}}
+	for rows.Next() {
+		var e HoldEconomy
+		err = rows.Scan(&e.Version, &e.Unit, &e.Wave, &e.PositionHash, &e.Workers, &e.ValueBucket, &e.Games, &e.Won, &e.Held)
+		if err != nil {
+			return nil, err
+		}
+		out.Games += e.Games
+		addEconomy(workers, e.Workers, e)
+		addEconomy(values, e.ValueBucket, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	out.Workers = economyBuckets(workers)
+	out.Value = economyBuckets(values)
+	return out, nil
+}
+
+func addEconomy(buckets map[int]*EconomyBucket, bucket int, e HoldEconomy) {
+	b, ok := buckets[bucket]
+	if !ok {
+		b = &EconomyBucket{Bucket: bucket}
+		buckets[bucket] = b
+	}
+	b.Games += e.Games
+	b.Won += e.Won
+	b.Held += e.Held
+}
+
+func economyBuckets(buckets map[int]*EconomyBucket) []*EconomyBucket {
+	out := make([]*EconomyBucket, 0, len(buckets))
+	for _, b := range buckets {
+		b.Winrate = util.Percent(b.Won, b.Games)
+		b.Holdrate = util.Percent(b.Held, b.Games)
+		out = append(out, b)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Bucket < out[j].Bucket
+	})
+	return out
+}
@@ -5,10 +5,11 @@ import (
 	"fmt"
 )
 
-const getHoldsQuery = `SELECT id, position_hash, position, total_value, won, lost, workers, version_added, player FROM %s where position_hash = '%s' and version_added = '%s'`
-const getHoldsByIDQuery = `SELECT id, position_hash, position, total_value, won, lost, workers, version_added, player FROM %s where id = '%v'`
-const saveHoldQuery = `INSERT INTO %s(position_hash, position, total_value, won, lost, workers, version_added, player) VALUES(?,?,?,?,?,?,?,?)`
-const updateHoldQuery = `UPDATE %s SET won = ?, lost = ?, workers = ? where id = ?`
+const getHoldsQuery = `SELECT id, position_hash, position, total_value, won, lost, workers, elo, elo_games, version_added, player FROM %s where position_hash = '%s' and version_added = '%s'`
+const getHoldsByIDQuery = `SELECT id, position_hash, position, total_value, won, lost, workers, elo, elo_games, version_added, player FROM %s where id = '%v'`
+const saveHoldQuery = `INSERT INTO %s(position_hash, hold_hash, position, total_value, won, lost, workers, elo, elo_games, version_added, player) VALUES(?,?,?,?,?,?,?,?,?,?,?)`
+const getHoldsByStableIDQuery = `SELECT id, position_hash, position, total_value, won, lost, workers, elo, elo_games, version_added, player FROM %s where version_added = ? and hold_hash = ?`
+const updateHoldQuery = `UPDATE %s SET won = ?, lost = ?, workers = ?, elo = ?, elo_games = ? where id = ?`
 
 type Hold struct {
 	ID           int
@@ -18,6 +19,10 @@ type Hold struct {
 	Won          int
 	Lost         int
 	Workers      int
+	// summed over the EloGames games whose elo is known, holds ingested
+	// before elo tracking have more games than that
+	Elo          int64
+	EloGames     int
 	VersionAdded string
 	Player       string
 
@@ -35,7 +40,7 @@ func FindHold(db *sql.DB, tb string, hash string, version string) (*Hold, error)
 
 	var h Hold
 	for rows.Next() {
-		err = rows.Scan(&h.ID, &h.PositionHash, &h.Position, &h.TotalValue, &h.Won, &h.Lost, &h.Workers, &h.VersionAdded, &h.Player)
+		err = rows.Scan(&h.ID, &h.PositionHash, &h.Position, &h.TotalValue, &h.Won, &h.Lost, &h.Workers, &h.Elo, &h.EloGames, &h.VersionAdded, &h.Player)
 		return &h, err
 	}
 
@@ -52,13 +57,30 @@ func FindHoldByID(db *sql.DB, tb string, id int) (*Hold, error) {
 
 	var h Hold
 	for rows.Next() {
-		err = rows.Scan(&h.ID, &h.PositionHash, &h.Position, &h.TotalValue, &h.Won, &h.Lost, &h.Workers, &h.VersionAdded, &h.Player)
+		err = rows.Scan(&h.ID, &h.PositionHash, &h.Position, &h.TotalValue, &h.Won, &h.Lost, &h.Workers, &h.Elo, &h.EloGames, &h.VersionAdded, &h.Player)
 		return &h, err
 	}
 
 	return nil, nil
 }
 
+func FindHoldByStableID(db *sql.DB, id HoldID) (*Hold, error) {
+	q := fmt.Sprintf(getHoldsByStableIDQuery, id.TableName()+"_holds")
+	rows, err := db.Query(q, id.Version, id.Hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var h Hold
+	for rows.Next() {
+		err = rows.Scan(&h.ID, &h.PositionHash, &h.Position, &h.TotalValue, &h.Won, &h.Lost, &h.Workers, &h.Elo, &h.EloGames, &h.VersionAdded, &h.Player)
+		return &h, err
+	}
+
+	return nil, rows.Err()
+}
+
 func (h *Hold) SaveHold(db *sql.DB, tb string) (int, error) {
 	tx, err := db.Begin()
 	if err != nil {
@@ -73,7 +95,7 @@ func (h *Hold) SaveHold(db *sql.DB, tb string) (int, error) {
 	}
 	defer stmt.Close()
 
-	resp, err := stmt.Exec(h.PositionHash, h.Position, h.TotalValue, h.Won, h.Lost, h.Workers, h.VersionAdded, h.Player)
+	resp, err := stmt.Exec(h.PositionHash, HashPosition(h.PositionHash), h.Position, h.TotalValue, h.Won, h.Lost, h.Workers, h.Elo, h.EloGames, h.VersionAdded, h.Player)
 	if err != nil {
 		return 0, err
 	}
@@ -105,7 +127,7 @@ func (h *Hold) UpdateHold(db *sql.DB, tb string) error {
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(h.Won, h.Lost, h.Workers, h.ID)
+	_, err = stmt.Exec(h.Won, h.Lost, h.Workers, h.Elo, h.EloGames, h.ID)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,65 @@
+package dynamicdata
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/antonite/ltd-meta-server/util"
+)
+
+const holdHashLength = 16
+
+var ErrInvalidHoldID = errors.New("hold id must look like <unit>-<wave>-<version>-<hash>")
+
+// HoldID identifies a hold across tables and re-ingestion, unlike the per
+// table auto increment id
+type HoldID struct {
+	Unit    string
+	Wave    int
+	Version string
+	Hash    string
+}
+
+func NewHoldID(unitID string, wave int, version string, positionHash string) HoldID {
+	return HoldID{Unit: unitID, Wave: wave, Version: version, Hash: HashPosition(positionHash)}
+}
+
+func HashPosition(positionHash string) string {
+	sum := sha1.Sum([]byte(positionHash))
+	return hex.EncodeToString(sum[:])[:holdHashLength]
+}
+
+func (id HoldID) String() string {
+	return strings.Join([]string{strings.TrimSuffix(id.Unit, "_unit_id"), strconv.Itoa(id.Wave), id.Version, id.Hash}, "-")
+}
+
+func (id HoldID) TableName() string {
+	return util.GenerateUnitTableName(id.Unit, id.Wave)
+}
+
+func ParseHoldID(s string) (HoldID, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) < 4 {
+		return HoldID{}, ErrInvalidHoldID
+	}
+	n := len(parts)
+	wave, err := strconv.Atoi(parts[n-3])
+	if err != nil || wave < 1 || wave > util.Waves {
+		return HoldID{}, ErrInvalidHoldID
+	}
+	hash := parts[n-1]
+	if len(hash) != holdHashLength {
+		return HoldID{}, ErrInvalidHoldID
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return HoldID{}, ErrInvalidHoldID
+	}
+	unit := strings.Join(parts[:n-3], "-")
+	if unit == "" || parts[n-2] == "" {
+		return HoldID{}, ErrInvalidHoldID
+	}
+	return HoldID{Unit: unit + "_unit_id", Wave: wave, Version: parts[n-2], Hash: hash}, nil
+}
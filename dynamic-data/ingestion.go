@@ -0,0 +1,54 @@
+package dynamicdata
+
+import (
+	"database/sql"
+	"time"
+)
+
+const startIngestionRunQuery = `INSERT INTO ingestion_run(started_at) VALUES(?)`
+const finishIngestionRunQuery = `UPDATE ingestion_run SET finished_at = ? where id = ?`
+const getLatestIngestionRunQuery = `SELECT id, started_at, finished_at FROM ingestion_run where finished_at is not null ORDER BY id DESC LIMIT 1`
+
+type IngestionRun struct {
+	ID         int
+	StartedAt  time.Time
+	FinishedAt sql.NullTime
+}
+
+func StartIngestionRun(db *sql.DB) (*IngestionRun, error) {
+	run := &IngestionRun{StartedAt: time.Now().UTC()}
+	resp, err := db.Exec(startIngestionRunQuery, run.StartedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := resp.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	run.ID = int(id)
+
+	return run, nil
+}
+
+func (run *IngestionRun) Finish(db *sql.DB) error {
+	run.FinishedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+	_, err := db.Exec(finishIngestionRunQuery, run.FinishedAt.Time, run.ID)
+	return err
+}
+
+func GetLatestIngestionRun(db *sql.DB) (*IngestionRun, error) {
+	rows, err := db.Query(getLatestIngestionRunQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var run IngestionRun
+	for rows.Next() {
+		err = rows.Scan(&run.ID, &run.StartedAt, &run.FinishedAt)
+		return &run, err
+	}
+
+	return nil, rows.Err()
+}
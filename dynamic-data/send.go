@@ -9,6 +9,7 @@ const findSendQuery = `SELECT id, holds_id, sends, held, leaked, leaked_amount F
 const insertSendsQuery = `INSERT INTO %s(holds_id, sends, held, leaked, leaked_amount) VALUES(?,?,?,?,?)`
 const updateSendsQuery = `UPDATE %s SET held = ?, leaked = ?, leaked_amount = ? where id = ?`
 const getTopSendsQuery = `SELECT holds_id, sends, held, leaked, leaked_amount FROM %s`
+const getHoldSendsQuery = `SELECT id, holds_id, sends, held, leaked, leaked_amount FROM %s where holds_id = ?`
 
 type Send struct {
 	ID           int
@@ -99,6 +100,27 @@ func (s *Send) UpdateSend(db *sql.DB, tb string) error {
 	return err
 }
 
+func GetHoldSends(db *sql.DB, tb string, holdsID int) ([]*Send, error) {
+	q := fmt.Sprintf(getHoldSendsQuery, tb)
+	rows, err := db.Query(q, holdsID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sends := []*Send{}
+	for rows.Next() {
+		var s Send
+		err = rows.Scan(&s.ID, &s.HoldsID, &s.Sends, &s.Held, &s.Leaked, &s.LeakedAmount)
+		if err != nil {
+			return nil, err
+		}
+		sends = append(sends, &s)
+	}
+
+	return sends, rows.Err()
+}
+
 func getTopSends(db *sql.DB, tb string) ([]*Send, error) {
 	q := fmt.Sprintf(getTopSendsQuery, tb)
 	rows, err := db.Query(q)
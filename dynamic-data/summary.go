@@ -0,0 +1,66 @@
+package dynamicdata
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/antonite/ltd-meta-server/util"
+)
+
+const unitWaveSummaryQuery = `SELECT h.won, h.lost, h.elo, h.elo_games, h.total_value, coalesce(sum(s.held), 0), coalesce(sum(s.leaked), 0) FROM %s h LEFT JOIN %s s ON s.holds_id = h.id where h.version_added = ? GROUP BY h.id`
+
+// UnitWaveSummary adds up every hold of a primary unit on one wave
+type UnitWaveSummary struct {
+	Games int
+	Won   int
+	Held  int
+	// sends only exist for a subset of games so Held is out of Sends
+	Sends int
+	// total value summed per game, divide by Games for the average board
+	Value int
+}
+
+func (s *UnitWaveSummary) Add(o *UnitWaveSummary) {
+	s.Games += o.Games
+	s.Won += o.Won
+	s.Held += o.Held
+	s.Sends += o.Sends
+	s.Value += o.Value
+}
+
+// GetUnitWaveSummary sums the holds of the unit on the wave for every bracket
+// in one pass, holds count towards a bracket by their average elo
+func GetUnitWaveSummary(db *sql.DB, primary string, wave int, version string) (map[string]*UnitWaveSummary, error) {
+	tn := util.GenerateUnitTableName(primary, wave)
+	rows, err := db.Query(fmt.Sprintf(unitWaveSummaryQuery, tn+"_holds", tn+"_sends"), version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string]*UnitWaveSummary, len(Brackets))
+	for _, b := range Brackets {
+		out[b.Name] = &UnitWaveSummary{}
+	}
+	for rows.Next() {
+		var h Hold
+		var held, leaked int
+		if err := rows.Scan(&h.Won, &h.Lost, &h.Elo, &h.EloGames, &h.TotalValue, &held, &leaked); err != nil {
+			return nil, err
+		}
+		games := h.Won + h.Lost
+		for _, b := range Brackets {
+			if h.AverageElo() < b.MinElo {
+				continue
+			}
+			s := out[b.Name]
+			s.Games += games
+			s.Won += h.Won
+			s.Held += held
+			s.Sends += held + leaked
+			s.Value += h.TotalValue * games
+		}
+	}
+
+	return out, rows.Err()
+}
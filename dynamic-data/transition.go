@@ -0,0 +1,78 @@
+package dynamicdata
+
+import (
+	"database/sql"
+)
+
+const upsertTransitionQuery = `INSERT INTO hold_transition(version, from_unit, from_wave, from_hash, to_unit, to_hash, games, won) VALUES(?,?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE games = games + VALUES(games), won = won + VALUES(won)`
+const getTransitionsQuery = `SELECT version, from_unit, from_wave, from_hash, to_unit, to_hash, games, won FROM hold_transition where version = ? and from_unit = ? and from_wave = ? and from_hash = ? ORDER BY games DESC LIMIT ?`
+const getVersionTransitionsQuery = `SELECT version, from_unit, from_wave, from_hash, to_unit, to_hash, games, won FROM hold_transition where version = ? and games >= ?`
+
+// HoldTransition counts how often players went from one hold to another on
+// the following wave
+type HoldTransition struct {
+	Version  string
+	FromUnit string
+	FromWave int
+	FromHash string
+	ToUnit   string
+	ToHash   string
+	Games    int
+	Won      int
+}
+
+func (t *HoldTransition) From() HoldID {
+	return HoldID{Unit: t.FromUnit, Wave: t.FromWave, Version: t.Version, Hash: t.FromHash}
+}
+
+func (t *HoldTransition) To() HoldID {
+	return HoldID{Unit: t.ToUnit, Wave: t.FromWave + 1, Version: t.Version, Hash: t.ToHash}
+}
+
+func (t *HoldTransition) Upsert(db *sql.DB) error {
+	_, err := db.Exec(upsertTransitionQuery, t.Version, t.FromUnit, t.FromWave, t.FromHash, t.ToUnit, t.ToHash, t.Games, t.Won)
+	return err
+}
+
+func GetTransitions(db *sql.DB, from HoldID, limit int) ([]*HoldTransition, error) {
+	return queryTransitions(db, getTransitionsQuery, from.Version, from.Unit, from.Wave, from.Hash, limit)
+}
+
+// GetVersionTransitions returns every transition seen at least minGames times
+// keyed by the from and to hold ids
+func GetVersionTransitions(db *sql.DB, version string, minGames int) (map[string]map[string]bool, error) {
+	transitions, err := queryTransitions(db, getVersionTransitionsQuery, version, minGames)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]map[string]bool)
+	for _, t := range transitions {
+		from := t.From().String()
+		if _, ok := out[from]; !ok {
+			out[from] = make(map[string]bool)
+		}
+		out[from][t.To().String()] = true
+	}
+	return out, nil
+}
+
+func queryTransitions(db *sql.DB, q string, args ...interface{}) ([]*HoldTransition, error) {
+	rows, err := db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transitions := []*HoldTransition{}
+	for rows.Next() {
+		var t HoldTransition
+		err = rows.Scan(&t.Version, &t.FromUnit, &t.FromWave, &t.FromHash, &t.ToUnit, &t.ToHash, &t.Games, &t.Won)
+		if err != nil {
+			return nil, err
+		}
+		transitions = append(transitions, &t)
+	}
+
+	return transitions, rows.Err()
+}
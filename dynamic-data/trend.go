@@ -0,0 +1,71 @@
+package dynamicdata
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/antonite/ltd-meta-server/util"
+)
+
+const upsertTrendQuery = `INSERT INTO unit_trend(day, version, unit, wave, games, won, held) VALUES(?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE games = games + VALUES(games), won = won + VALUES(won), held = held + VALUES(held)`
+const getUnitTrendQuery = `SELECT t.day, t.wave, t.games, t.won, t.held, w.games FROM unit_trend t JOIN (SELECT day, wave, sum(games) as games FROM unit_trend where version = ? GROUP BY day, wave) w ON t.day = w.day AND t.wave = w.wave where t.version = ? and t.unit = ? ORDER BY t.wave, t.day`
+
+// UnitTrend counts the boards built around a primary unit on one wave of one
+// day, every board is counted so pick rates are against the whole wave
+type UnitTrend struct {
+	Day     time.Time
+	Version string
+	Unit    string
+	Wave    int
+	Games   int
+	Won     int
+	Held    int
+}
+
+func (t *UnitTrend) Upsert(db *sql.DB) error {
+	_, err := db.Exec(upsertTrendQuery, t.Day.Format("2006-01-02"), t.Version, t.Unit, t.Wave, t.Games, t.Won, t.Held)
+	return err
+}
+
+type TrendPoint struct {
+	Day      string
+	Games    int
+	PickRate float64
+	HoldRate float64
+	Winrate  float64
+}
+
+type WaveTrend struct {
+	Wave   int
+	Points []*TrendPoint
+}
+
+// GetUnitTrend returns a daily series per wave for the unit, oldest day first
+func GetUnitTrend(db *sql.DB, version string, unitID string) ([]*WaveTrend, error) {
+	rows, err := db.Query(getUnitTrendQuery, version, version, unitID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []*WaveTrend{}
+	var current *WaveTrend
+	for rows.Next() {
+		var day time.Time
+		var wave, games, won, held, waveGames int
+		if err := rows.Scan(&day, &wave, &games, &won, &held, &waveGames); err != nil {
+			return nil, err
+		}
+		if current == nil || current.Wave != wave {
+			current = &WaveTrend{Wave: wave, Points: []*TrendPoint{}}
+			out = append(out, current)
+		}
+		p := &TrendPoint{Day: day.Format("2006-01-02"), Games: games}
+		p.HoldRate = util.Percent(held, games)
+		p.Winrate = util.Percent(won, games)
+		p.PickRate = util.Percent(games, waveGames)
+		current.Points = append(current.Points, p)
+	}
+
+	return out, rows.Err()
+}
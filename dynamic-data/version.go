@@ -3,10 +3,13 @@ package dynamicdata
 import (
 	"database/sql"
 	"sort"
+	"strconv"
+	"strings"
 )
 
 const selectVersions = "select distinct version_added from nightmare_wave_1_holds"
 
+// GetVersions returns every version with data, oldest first
 func GetVersions(db *sql.DB) ([]string, error) {
 	rows, err := db.Query(selectVersions)
 	if err != nil {
@@ -21,7 +24,56 @@ func GetVersions(db *sql.DB) ([]string, error) {
 		versions = append(versions, v)
 	}
 
-	sort.Strings(versions)
+	SortVersions(versions)
 
 	return versions, nil
 }
+
+// SortVersions orders versions oldest first, comparing each dot separated
+// part numerically so "9.10" comes before "10.01"
+func SortVersions(versions []string) {
+	sort.Slice(versions, func(i, j int) bool {
+		return CompareVersions(versions[i], versions[j]) < 0
+	})
+}
+
+// LatestVersion returns the newest of versions, "" when there are none
+func LatestVersion(versions []string) string {
+	latest := ""
+	for _, v := range versions {
+		if latest == "" || CompareVersions(v, latest) > 0 {
+			latest = v
+		}
+	}
+	return latest
+}
+
+// CompareVersions returns -1, 0 or 1 as a is older, equal to or newer than b.
+// Parts that aren't numbers, like a leading "v", compare as strings.
+func CompareVersions(a, b string) int {
+	ap := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bp := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(ap) && i < len(bp); i++ {
+		an, aerr := strconv.Atoi(ap[i])
+		bn, berr := strconv.Atoi(bp[i])
+		if aerr == nil && berr == nil {
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+			continue
+		}
+		if c := strings.Compare(ap[i], bp[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(ap) < len(bp):
+		return -1
+	case len(ap) > len(bp):
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/antonite/ltd-meta-server/config"
+	"github.com/antonite/ltd-meta-server/db"
+	"github.com/antonite/ltd-meta-server/guide"
+	"github.com/antonite/ltd-meta-server/unit"
+)
+
+func diffGuides(cfg *config.Config, args []string) error {
+	if len(args) < 1 {
+		return errors.New("usage: generator diff <from generation> [to generation]")
+	}
+
+	database, err := db.New(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	fromID, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid from generation: %s", args[0])
+	}
+	from, err := guide.GetGeneration(database, fromID)
+	if err != nil {
+		return err
+	}
+	if from == nil {
+		return fmt.Errorf("generation %d not found", fromID)
+	}
+
+	var to *guide.Generation
+	if len(args) > 1 {
+		toID, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid to generation: %s", args[1])
+		}
+		to, err = guide.GetGeneration(database, toID)
+		if err != nil {
+			return err
+		}
+	} else {
+		to, err = guide.GetLatestGeneration(database)
+		if err != nil {
+			return err
+		}
+	}
+	if to == nil {
+		return errors.New("to generation not found")
+	}
+
+	units, err := unit.GetAll(database)
+	if err != nil {
+		return err
+	}
+	names := make(map[int]string)
+	for _, u := range units {
+		names[u.ID] = u.Name
+	}
+	pair := func(main, secondary int) string {
+		return fmt.Sprintf("%s + %s", names[main], names[secondary])
+	}
+
+	d := guide.Compare(from, to)
+	fmt.Printf("guide diff: generation %d (%s) -> generation %d (%s)\n", d.From.ID, d.From.Version, d.To.ID, d.To.Version)
+
+	fmt.Printf("\nentered top list (%d):\n", len(d.Entered))
+	for _, g := range d.Entered {
+		fmt.Printf("  %-40s score %d, winrate %d%%\n", pair(g.MainUnitID, g.SecondaryUnitID), g.Score, g.Winrate)
+	}
+
+	fmt.Printf("\nleft top list (%d):\n", len(d.Left))
+	for _, g := range d.Left {
+		fmt.Printf("  %-40s score %d, winrate %d%%\n", pair(g.MainUnitID, g.SecondaryUnitID), g.Score, g.Winrate)
+	}
+
+	fmt.Printf("\nstayed in top list (%d):\n", len(d.Moved))
+	for _, c := range d.Moved {
+		fmt.Printf("  %-40s rank %d -> %d, score %d -> %d (%+d), winrate %d%% -> %d%% (%+d)\n", pair(c.MainUnitID, c.SecondaryUnitID), c.RankFrom, c.RankTo, c.ScoreFrom, c.ScoreTo, c.ScoreDelta, c.WinrateFrom, c.WinrateTo, c.WinrateDelta)
+		for _, w := range c.Waves {
+			fmt.Printf("      wave %d board changed, value %d -> %d\n", w.Wave, w.ValueFrom, w.ValueTo)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/antonite/ltd-meta-server/config"
+	"github.com/antonite/ltd-meta-server/db"
+	"github.com/antonite/ltd-meta-server/ltdapi"
+	"github.com/antonite/ltd-meta-server/pipeline"
+)
+
+func trainModel(cfg *config.Config, args []string) error {
+	days := pipeline.DefaultTrainDays
+	if len(args) > 0 {
+		d, err := strconv.Atoi(args[0])
+		if err != nil || d < 1 {
+			return errors.New("usage: generator train [days]")
+		}
+		days = d
+	}
+
+	database, err := db.New(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	p := pipeline.New(database, ltdapi.New(cfg.API.Key), cfg.Generator)
+	model, err := p.Train(pipeline.NewJob("train", nil), days)
+	if err != nil {
+		return err
+	}
+	if model == nil {
+		return errors.New("no games found")
+	}
+
+	c := model.Coefficients
+	fmt.Printf("model %d for %s trained on %d samples\n", model.ID, model.Version, model.Samples)
+	fmt.Printf("intercept %.3f wave %.3f value %.3f workers %.3f leaked %.3f, %d primaries\n", c.Intercept, c.Wave, c.Value, c.Workers, c.Leaked, len(c.Primaries))
+	return nil
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"github.com/antonite/ltd-meta-server/config"
+	"github.com/antonite/ltd-meta-server/db"
+	"github.com/antonite/ltd-meta-server/ltdapi"
+	"github.com/antonite/ltd-meta-server/pipeline"
+)
+
+func upgradeTables(cfg *config.Config) error {
+	database, err := db.New(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	p := pipeline.New(database, ltdapi.New(cfg.API.Key), cfg.Generator)
+	return p.UpgradeTables(pipeline.NewJob("upgrade", nil))
+}
@@ -0,0 +1,139 @@
+package guide
+
+import (
+	"fmt"
+	"sort"
+)
+
+type Diff struct {
+	From    *Generation
+	To      *Generation
+	Entered []Guide
+	Left    []Guide
+	Moved   []GuideChange
+}
+
+type GuideChange struct {
+	MainUnitID      int
+	SecondaryUnitID int
+	RankFrom        int
+	RankTo          int
+	ScoreFrom       int
+	ScoreTo         int
+	ScoreDelta      int
+	WinrateFrom     int
+	WinrateTo       int
+	WinrateDelta    int
+	Waves           []WaveChange
+}
+
+type WaveChange struct {
+	Wave         int
+	PositionFrom string
+	PositionTo   string
+	ValueFrom    int
+	ValueTo      int
+}
+
+func Compare(from *Generation, to *Generation) Diff {
+	d := Diff{
+		From:    metadata(from),
+		To:      metadata(to),
+		Entered: []Guide{},
+		Left:    []Guide{},
+		Moved:   []GuideChange{},
+	}
+
+	fromRanks := rankGuides(from.Guides)
+	toRanks := rankGuides(to.Guides)
+
+	for i, g := range to.Guides {
+		r, ok := fromRanks[pairKey(g)]
+		if !ok {
+			d.Entered = append(d.Entered, g)
+			continue
+		}
+		old := from.Guides[r]
+		change := GuideChange{
+			MainUnitID:      g.MainUnitID,
+			SecondaryUnitID: g.SecondaryUnitID,
+			RankFrom:        r + 1,
+			RankTo:          i + 1,
+			ScoreFrom:       old.Score,
+			ScoreTo:         g.Score,
+			ScoreDelta:      g.Score - old.Score,
+			WinrateFrom:     old.Winrate,
+			WinrateTo:       g.Winrate,
+			WinrateDelta:    g.Winrate - old.Winrate,
+			Waves:           compareWaves(old.Waves, g.Waves),
+		}
+		d.Moved = append(d.Moved, change)
+	}
+
+	for _, g := range from.Guides {
+		if _, ok := toRanks[pairKey(g)]; !ok {
+			d.Left = append(d.Left, g)
+		}
+	}
+
+	sort.SliceStable(d.Moved, func(i, j int) bool {
+		return abs(d.Moved[i].ScoreDelta) > abs(d.Moved[j].ScoreDelta)
+	})
+
+	return d
+}
+
+func compareWaves(from []WaveGuide, to []WaveGuide) []WaveChange {
+	changes := []WaveChange{}
+	for i := 0; i < len(from) || i < len(to); i++ {
+		var f, t WaveGuide
+		if i < len(from) {
+			f = from[i]
+		}
+		if i < len(to) {
+			t = to[i]
+		}
+		if f.PositionHash == t.PositionHash {
+			continue
+		}
+		changes = append(changes, WaveChange{
+			Wave:         i + 1,
+			PositionFrom: f.Position,
+			PositionTo:   t.Position,
+			ValueFrom:    f.Value,
+			ValueTo:      t.Value,
+		})
+	}
+	return changes
+}
+
+func rankGuides(guides []Guide) map[string]int {
+	ranks := make(map[string]int, len(guides))
+	for i, g := range guides {
+		if _, ok := ranks[pairKey(g)]; !ok {
+			ranks[pairKey(g)] = i
+		}
+	}
+	return ranks
+}
+
+func metadata(gen *Generation) *Generation {
+	return &Generation{
+		ID:         gen.ID,
+		Version:    gen.Version,
+		Scorer:     gen.Scorer,
+		Parameters: gen.Parameters,
+		CreatedAt:  gen.CreatedAt,
+	}
+}
+
+func pairKey(g Guide) string {
+	return fmt.Sprintf("%d_%d", g.MainUnitID, g.SecondaryUnitID)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,118 @@
+package guide
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+//go:embed filters.json
+var defaultFilters []byte
+
+type Filter struct {
+	Name    string
+	Type    string
+	Wave    int
+	Mythium int
+	Value   float64
+}
+
+type Rejection struct {
+	MainUnitID      int
+	SecondaryUnitID int
+	Score           int
+	Filter          string
+	Reason          string
+}
+
+func LoadFilters(path string) ([]Filter, error) {
+	data := defaultFilters
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		data = b
+	}
+
+	filters := []Filter{}
+	if err := json.Unmarshal(data, &filters); err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for _, f := range filters {
+		if f.Name == "" {
+			return nil, fmt.Errorf("guide filter is missing a name: %+v", f)
+		}
+		if names[f.Name] {
+			return nil, fmt.Errorf("duplicate guide filter: %s", f.Name)
+		}
+		names[f.Name] = true
+		if err := f.validate(); err != nil {
+			return nil, fmt.Errorf("filter %s: %v", f.Name, err)
+		}
+	}
+
+	return filters, nil
+}
+
+func ApplyFilters(c Candidate, filters []Filter) *Rejection {
+	for _, f := range filters {
+		reason, rejected := f.reject(c)
+		if !rejected {
+			continue
+		}
+		return &Rejection{
+			MainUnitID:      c.Guide.MainUnitID,
+			SecondaryUnitID: c.Guide.SecondaryUnitID,
+			Score:           c.Guide.Score,
+			Filter:          f.Name,
+			Reason:          reason,
+		}
+	}
+	return nil
+}
+
+func (f Filter) validate() error {
+	switch f.Type {
+	case "max_value_without_cheap_unit", "max_send_leak_ratio":
+		if f.Wave < 1 || f.Wave > Waves {
+			return fmt.Errorf("%s needs a wave between 1 and %d", f.Type, Waves)
+		}
+	case "require_secondary":
+	default:
+		return fmt.Errorf("unknown filter type: %s", f.Type)
+	}
+	return nil
+}
+
+func (f Filter) reject(c Candidate) (string, bool) {
+	g := c.Guide
+	switch f.Type {
+	case "max_value_without_cheap_unit":
+		if f.Wave > len(g.Waves) {
+			return "", false
+		}
+		// skip overbuilding
+		v := g.Waves[f.Wave-1].Value
+		if float64(v) > f.Value && !c.HasCheapUnit {
+			return fmt.Sprintf("wave %d value %d is above %v with no cheap unit", f.Wave, v, f.Value), true
+		}
+	case "max_send_leak_ratio":
+		if f.Wave > len(g.Waves) {
+			return "", false
+		}
+		// dont include any hyper aggressive leaking waves
+		for _, s := range g.Waves[f.Wave-1].Sends {
+			if (f.Mythium == 0 || s.TotalMythium == f.Mythium) && float64(s.LeakedRatio) > f.Value {
+				return fmt.Sprintf("wave %d send %q (%d mythium) leaks %d%%, above %v%%", f.Wave, s.Sends, s.TotalMythium, s.LeakedRatio, f.Value), true
+			}
+		}
+	case "require_secondary":
+		if g.SecondaryUnitID == 0 {
+			return "no secondary unit found on any wave", true
+		}
+	}
+	return "", false
+}
@@ -19,6 +19,12 @@ type Guide struct {
 	Workers         float64
 	Waves           []WaveGuide
 	Mastermind      string
+	Legion          string
+	Games           int
+
+	MastermindRule       string
+	MastermindReason     string
+	MastermindConfidence float64
 }
 
 type WaveGuide struct {
@@ -29,15 +35,19 @@ type WaveGuide struct {
 	Winrate      int
 	Sends        []*dynamicdata.Send
 	Workers      float64
+	Games        int
 	Player       string
+	HoldID       string
 }
 
-func GenerateGuides(uid int, smap map[int]map[int][]*dynamicdata.Stats, upgrades map[string][]string, specials []string) []Guide {
+// observed maps hold ids to the hold ids players were seen moving to on the
+// next wave, for holds in it it replaces matching successors by position
+func GenerateGuides(uid int, smap map[int]map[int][]*dynamicdata.Stats, upgrades map[string][]string, specials []string, legions map[int]string, observed map[string]map[string]bool) []Guide {
 	wGuides := make(map[int]WaveGuide, Waves)
-	return guideHelper(uid, 1, wGuides, smap, upgrades, specials)
+	return guideHelper(uid, 1, wGuides, smap, upgrades, specials, legions, observed)
 }
 
-func guideHelper(uid int, wave int, guides map[int]WaveGuide, smap map[int]map[int][]*dynamicdata.Stats, upgrades map[string][]string, specials []string) []Guide {
+func guideHelper(uid int, wave int, guides map[int]WaveGuide, smap map[int]map[int][]*dynamicdata.Stats, upgrades map[string][]string, specials []string, legions map[int]string, observed map[string]map[string]bool) []Guide {
 	if wave > Waves {
 		score := 0
 		winrate := 0
@@ -68,6 +78,8 @@ func guideHelper(uid int, wave int, guides map[int]WaveGuide, smap map[int]map[i
 			Winrate: winrate,
 			Waves:   waves,
 			Workers: workers,
+			Legion:  legions[uid],
+			Games:   SampleSize(waves),
 		}
 		return []Guide{guide}
 	}
@@ -82,15 +94,22 @@ func guideHelper(uid int, wave int, guides map[int]WaveGuide, smap map[int]map[i
 				Winrate:      s.Winrate,
 				Sends:        s.Sends,
 				Workers:      s.Workers,
+				Games:        s.Games,
 				Player:       s.Player,
+				HoldID:       s.HoldID,
 			}
 			guides[wave] = wg
-			gout = append(gout, guideHelper(uid, wave+1, guides, smap, upgrades, specials)...)
+			gout = append(gout, guideHelper(uid, wave+1, guides, smap, upgrades, specials, legions, observed)...)
 		}
 	} else {
-		for _, v := range smap {
+		for k, v := range smap {
+			// players are locked to a single legion's fighters, a unit whose
+			// legion isn't known yet only continues into itself
+			if k != uid && (legions[uid] == "" || legions[uid] != legions[k]) {
+				continue
+			}
 			for _, s := range v[wave] {
-				if s.Workers >= guides[wave-1].Workers && matchBuildHash(guides[wave-1].PositionHash, s.Hash, upgrades, specials) {
+				if s.Workers >= guides[wave-1].Workers && follows(guides[wave-1], s, upgrades, specials, observed) {
 					wg := WaveGuide{
 						Position:     s.Position,
 						PositionHash: s.Hash,
@@ -99,10 +118,12 @@ func guideHelper(uid int, wave int, guides map[int]WaveGuide, smap map[int]map[i
 						Winrate:      s.Winrate,
 						Sends:        s.Sends,
 						Workers:      s.Workers,
+						Games:        s.Games,
 						Player:       s.Player,
+						HoldID:       s.HoldID,
 					}
 					guides[wave] = wg
-					gout = append(gout, guideHelper(uid, wave+1, guides, smap, upgrades, specials)...)
+					gout = append(gout, guideHelper(uid, wave+1, guides, smap, upgrades, specials, legions, observed)...)
 				}
 			}
 		}
@@ -111,7 +132,15 @@ func guideHelper(uid int, wave int, guides map[int]WaveGuide, smap map[int]map[i
 	return gout
 }
 
-func matchBuildHash(firstHash string, secondHash string, upgrades map[string][]string, specials []string) bool {
+func follows(prev WaveGuide, s *dynamicdata.Stats, upgrades map[string][]string, specials []string, observed map[string]map[string]bool) bool {
+	// holds nobody was seen leaving yet still match by position
+	if next := observed[prev.HoldID]; len(next) > 0 {
+		return next[s.HoldID]
+	}
+	return MatchBuildHash(prev.PositionHash, s.Hash, upgrades, specials)
+}
+
+func MatchBuildHash(firstHash string, secondHash string, upgrades map[string][]string, specials []string) bool {
 	firstUnits := strings.Split(firstHash, ",")
 	secondUnits := strings.Split(secondHash, ",")
 	viableDiffs := make(map[float64]bool)
@@ -183,3 +212,14 @@ func matchBuildHash(firstHash string, secondHash string, upgrades map[string][]s
 	}
 	return true
 }
+
+// SampleSize is the number of games behind the least played wave of a guide
+func SampleSize(waves []WaveGuide) int {
+	games := 0
+	for i, w := range waves {
+		if i == 0 || w.Games < games {
+			games = w.Games
+		}
+	}
+	return games
+}
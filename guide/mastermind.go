@@ -0,0 +1,172 @@
+package guide
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+//go:embed mastermind.json
+var defaultMastermindRules []byte
+
+type MastermindRule struct {
+	Name       string
+	Mastermind string
+	Reason     string
+	Confidence float64
+	Conditions []Condition
+}
+
+type Condition struct {
+	Metric string
+	Wave   int
+	Op     string
+	Value  float64
+}
+
+type Candidate struct {
+	Guide        *Guide
+	HasCheapUnit bool
+}
+
+func LoadMastermindRules(path string) ([]MastermindRule, error) {
+	data := defaultMastermindRules
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		data = b
+	}
+
+	rules := []MastermindRule{}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	for _, r := range rules {
+		if r.Name == "" || r.Mastermind == "" {
+			return nil, fmt.Errorf("mastermind rule is missing a name or mastermind: %+v", r)
+		}
+		for _, c := range r.Conditions {
+			if err := c.validate(); err != nil {
+				return nil, fmt.Errorf("rule %s: %v", r.Name, err)
+			}
+		}
+	}
+
+	return rules, nil
+}
+
+func ClassifyMastermind(c Candidate, rules []MastermindRule) {
+	g := c.Guide
+	// rules are ordered, first full match wins
+	for _, r := range rules {
+		if !r.matches(c) {
+			continue
+		}
+		g.Mastermind = r.Mastermind
+		g.MastermindRule = r.Name
+		g.MastermindReason = r.Reason
+		g.MastermindConfidence = r.Confidence
+		return
+	}
+
+	g.Mastermind = "Greed"
+	g.MastermindRule = ""
+	g.MastermindReason = "no mastermind rule matched"
+	g.MastermindConfidence = 0
+}
+
+func (r MastermindRule) matches(c Candidate) bool {
+	for _, cond := range r.Conditions {
+		v, ok := cond.metric(c)
+		if !ok || !cond.compare(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Condition) validate() error {
+	switch c.Metric {
+	case "value", "workers", "first_send_held", "first_send_leaked", "first_send_leak_ratio", "max_leak_ratio":
+		if c.Wave < 1 || c.Wave > Waves {
+			return fmt.Errorf("metric %s needs a wave between 1 and %d", c.Metric, Waves)
+		}
+	case "cheap_unit":
+	default:
+		return fmt.Errorf("unknown metric: %s", c.Metric)
+	}
+
+	switch c.Op {
+	case "==", "!=", ">", ">=", "<", "<=":
+	default:
+		return fmt.Errorf("unknown operator: %s", c.Op)
+	}
+
+	return nil
+}
+
+func (c Condition) metric(cand Candidate) (float64, bool) {
+	if c.Metric == "cheap_unit" {
+		if cand.HasCheapUnit {
+			return 1, true
+		}
+		return 0, true
+	}
+
+	if c.Wave > len(cand.Guide.Waves) {
+		return 0, false
+	}
+	w := cand.Guide.Waves[c.Wave-1]
+	switch c.Metric {
+	case "value":
+		return float64(w.Value), true
+	case "workers":
+		return w.Workers, true
+	case "first_send_held":
+		if len(w.Sends) == 0 {
+			return 0, false
+		}
+		return float64(w.Sends[0].Held), true
+	case "first_send_leaked":
+		if len(w.Sends) == 0 {
+			return 0, false
+		}
+		return float64(w.Sends[0].Leaked), true
+	case "first_send_leak_ratio":
+		if len(w.Sends) == 0 {
+			return 0, false
+		}
+		return float64(w.Sends[0].LeakedRatio), true
+	case "max_leak_ratio":
+		max := 0
+		for _, s := range w.Sends {
+			if s.LeakedRatio > max {
+				max = s.LeakedRatio
+			}
+		}
+		return float64(max), true
+	}
+
+	return 0, false
+}
+
+func (c Condition) compare(v float64) bool {
+	switch c.Op {
+	case "==":
+		return v == c.Value
+	case "!=":
+		return v != c.Value
+	case ">":
+		return v > c.Value
+	case ">=":
+		return v >= c.Value
+	case "<":
+		return v < c.Value
+	case "<=":
+		return v <= c.Value
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package guide
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+const saveRejectionQuery = `INSERT INTO guide_rejection(generation_id, unit_pair, rejected, filters, examples) VALUES(?,?,?,?,?)`
+const getRejectionsQuery = `SELECT unit_pair, rejected, filters, examples FROM guide_rejection where generation_id = ?`
+
+const maxRejectionExamples = 20
+
+// Rejections are the filter rejections of one generation keyed by PairKey
+type Rejections map[string]*PairRejections
+
+type PairRejections struct {
+	Rejected int
+	Filters  map[string]int
+	Examples []Rejection
+}
+
+// PairKey orders the two units so a pair is found whichever one is asked
+// about as the main unit
+func PairKey(a, b int) string {
+	if a > b {
+		a, b = b, a
+	}
+	return fmt.Sprintf("%d_%d", a, b)
+}
+
+func (r Rejections) Add(rej Rejection) {
+	key := PairKey(rej.MainUnitID, rej.SecondaryUnitID)
+	pr, ok := r[key]
+	if !ok {
+		pr = &PairRejections{Filters: make(map[string]int)}
+		r[key] = pr
+	}
+	pr.Rejected++
+	pr.Filters[rej.Filter]++
+	if len(pr.Examples) < maxRejectionExamples {
+		pr.Examples = append(pr.Examples, rej)
+	}
+}
+
+func saveRejections(tx *sql.Tx, generationID int64, rejections Rejections) error {
+	if len(rejections) == 0 {
+		return nil
+	}
+	stmt, err := tx.Prepare(saveRejectionQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for key, pr := range rejections {
+		filters, err := json.Marshal(pr.Filters)
+		if err != nil {
+			return err
+		}
+		examples, err := json.Marshal(pr.Examples)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.Exec(generationID, key, pr.Rejected, string(filters), string(examples)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func GetRejections(db *sql.DB, generationID int) (Rejections, error) {
+	rows, err := db.Query(getRejectionsQuery, generationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := Rejections{}
+	for rows.Next() {
+		var key, filters, examples string
+		pr := &PairRejections{}
+		if err := rows.Scan(&key, &pr.Rejected, &filters, &examples); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(filters), &pr.Filters); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(examples), &pr.Examples); err != nil {
+			return nil, err
+		}
+		out[key] = pr
+	}
+
+	return out, rows.Err()
+}
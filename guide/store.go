@@ -0,0 +1,170 @@
+package guide
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+const saveGenerationQuery = `INSERT INTO guide_generation(version, scorer, parameters, created_at) VALUES(?,?,?,?)`
+const saveGuideQuery = `INSERT INTO guide(generation_id, main_unit_id, secondary_unit_id, score, winrate, workers, mastermind, mastermind_rule, mastermind_reason, mastermind_confidence, legion, waves) VALUES(?,?,?,?,?,?,?,?,?,?,?,?)`
+const getGenerationsQuery = `SELECT id, version, scorer, parameters, created_at FROM guide_generation ORDER BY id DESC`
+const getGenerationQuery = `SELECT id, version, scorer, parameters, created_at FROM guide_generation where id = ?`
+const getLatestGenerationQuery = `SELECT id, version, scorer, parameters, created_at FROM guide_generation ORDER BY id DESC LIMIT 1`
+const getLatestVersionGenerationQuery = `SELECT id, version, scorer, parameters, created_at FROM guide_generation where version = ? ORDER BY id DESC LIMIT 1`
+const getGuidesQuery = `SELECT main_unit_id, secondary_unit_id, score, winrate, workers, mastermind, mastermind_rule, mastermind_reason, mastermind_confidence, legion, waves FROM guide where generation_id = ? ORDER BY score, id`
+
+type Generation struct {
+	ID         int
+	Version    string
+	Scorer     string
+	Parameters json.RawMessage
+	CreatedAt  time.Time
+	Guides     []Guide `json:",omitempty"`
+	// saved with the generation, loaded on demand with GetRejections
+	Rejections Rejections `json:"-"`
+}
+
+func (gen *Generation) Save(db *sql.DB) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(saveGenerationQuery)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	resp, err := stmt.Exec(gen.Version, gen.Scorer, string(gen.Parameters), gen.CreatedAt.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := resp.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	guideStmt, err := tx.Prepare(saveGuideQuery)
+	if err != nil {
+		return 0, err
+	}
+	defer guideStmt.Close()
+
+	for _, g := range gen.Guides {
+		waves, err := json.Marshal(g.Waves)
+		if err != nil {
+			return 0, err
+		}
+		_, err = guideStmt.Exec(id, g.MainUnitID, g.SecondaryUnitID, g.Score, g.Winrate, g.Workers, g.Mastermind, g.MastermindRule, g.MastermindReason, g.MastermindConfidence, g.Legion, string(waves))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := saveRejections(tx, id, gen.Rejections); err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	gen.ID = int(id)
+	return gen.ID, nil
+}
+
+func GetGenerations(db *sql.DB) ([]*Generation, error) {
+	rows, err := db.Query(getGenerationsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	gens := []*Generation{}
+	for rows.Next() {
+		gen, err := scanGeneration(rows)
+		if err != nil {
+			return nil, err
+		}
+		gens = append(gens, gen)
+	}
+
+	return gens, rows.Err()
+}
+
+func GetGeneration(db *sql.DB, id int) (*Generation, error) {
+	return findGeneration(db, getGenerationQuery, id)
+}
+
+func GetLatestGeneration(db *sql.DB) (*Generation, error) {
+	return findGeneration(db, getLatestGenerationQuery)
+}
+
+func GetLatestVersionGeneration(db *sql.DB, version string) (*Generation, error) {
+	return findGeneration(db, getLatestVersionGenerationQuery, version)
+}
+
+func findGeneration(db *sql.DB, query string, args ...interface{}) (*Generation, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	gen, err := scanGeneration(rows)
+	if err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	gen.Guides, err = getGuides(db, gen.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return gen, nil
+}
+
+func getGuides(db *sql.DB, generationID int) ([]Guide, error) {
+	rows, err := db.Query(getGuidesQuery, generationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	guides := []Guide{}
+	for rows.Next() {
+		var g Guide
+		var waves string
+		err = rows.Scan(&g.MainUnitID, &g.SecondaryUnitID, &g.Score, &g.Winrate, &g.Workers, &g.Mastermind, &g.MastermindRule, &g.MastermindReason, &g.MastermindConfidence, &g.Legion, &waves)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(waves), &g.Waves); err != nil {
+			return nil, err
+		}
+		g.Games = SampleSize(g.Waves)
+		guides = append(guides, g)
+	}
+
+	return guides, rows.Err()
+}
+
+func scanGeneration(rows *sql.Rows) (*Generation, error) {
+	var gen Generation
+	var params string
+	err := rows.Scan(&gen.ID, &gen.Version, &gen.Scorer, &params, &gen.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	gen.Parameters = json.RawMessage(params)
+	return &gen, nil
+}
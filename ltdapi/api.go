@@ -5,14 +5,20 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"sync"
 	"time"
+
+	"github.com/antonite/ltd-meta-server/metrics"
 )
 
 const url = "https://apiv2.legiontd2.com/games?limit=50&sortBy=date&sortDirection=1&includeDetails=true&dateAfter=%v&dateBefore=%v&offset=%v"
 const unitsUrl = "https://apiv2.legiontd2.com/units/byVersion/%s?limit=0"
 
+var (
+	apiRetries  = metrics.NewCounter("ltd_api_retries_total", "Retried LTD2 api requests.", "endpoint")
+	apiFailures = metrics.NewCounter("ltd_api_failures_total", "LTD2 api requests that failed every retry.", "endpoint")
+)
+
 type LtdApi struct {
 	Key string
 }
@@ -50,11 +56,11 @@ type Unit struct {
 	IncomeBonus   string
 	UnitClass     string
 	CategoryClass string
+	LegionId      string
 	UpgradesFrom  []string
 }
 
-func New() *LtdApi {
-	key := os.Getenv("apikey")
+func New(key string) *LtdApi {
 	return &LtdApi{
 		Key: key,
 	}
@@ -66,7 +72,7 @@ func (api *LtdApi) GetLatestVersion() (string, error) {
 		return "", err
 	}
 	req.Header.Set("x-api-key", api.Key)
-	client := &http.Client{}
+	client := &http.Client{Timeout: time.Second * 25}
 	resp, err := client.Do(req)
 	if err != nil || resp.StatusCode != 200 {
 		fmt.Println(resp)
@@ -170,6 +176,7 @@ func (api *LtdApi) getGames(offset int, startDate string, endDate string, w int)
 
 		if i > 0 {
 			fmt.Printf("worker %d retrying request #%d, %d\n", w, i, offset)
+			apiRetries.With("games").Inc()
 		}
 
 		resp, err = client.Do(req)
@@ -190,5 +197,6 @@ func (api *LtdApi) getGames(offset int, startDate string, endDate string, w int)
 	}
 
 	fmt.Printf("worker %d failed all tries %d\n", w, offset)
+	apiFailures.With("games").Inc()
 	return nil, err
 }
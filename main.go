@@ -1,42 +1,93 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/antonite/ltd-meta-server/config"
 	"github.com/antonite/ltd-meta-server/server"
 )
 
+const shutdownTimeout = time.Second * 30
+
 func main() {
-	srv, err := server.New()
+	cfg, _, err := config.Load("server", os.Args[1:])
 	if err != nil {
-		panic("failed to create server")
+		log.Fatal(err)
+	}
+	if err := cfg.Server.Validate(); err != nil {
+		log.Fatal(err)
 	}
 
-	cert := os.Getenv("cert_path")
-	key := os.Getenv("key_path")
-
-	http.HandleFunc("/units", func(w http.ResponseWriter, r *http.Request) {
-		srv.HandleGetUnits(w, r)
-	})
+	proxies, err := server.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	http.HandleFunc("/holds", func(w http.ResponseWriter, r *http.Request) {
-		srv.HandleGetTopHolds(w, r)
-	})
+	srv, err := server.New(cfg)
+	if err != nil {
+		log.Fatalf("failed to create server: %v", err)
+	}
 
-	http.HandleFunc("/versions", func(w http.ResponseWriter, r *http.Request) {
-		srv.HandleGetVersions(w, r)
-	})
+	addr := cfg.Server.Addr
+	mode := cfg.Server.Mode
+	cert := cfg.Server.CertPath
+	key := cfg.Server.KeyPath
 
-	http.HandleFunc("/guides", func(w http.ResponseWriter, r *http.Request) {
-		srv.HandleGetGuides(w, r)
-	})
+	httpServer := &http.Server{
+		Addr:              addr,
+		Handler:           srv.Routes(cfg.Server.AllowedOrigins, proxies),
+		ReadHeaderTimeout: time.Second * 10,
+	}
+	if mode == "tls" && cfg.Server.CertReload {
+		reloader, err := server.NewCertReloader(cert, key)
+		if err != nil {
+			log.Fatalf("failed to load certificate: %v", err)
+		}
+		httpServer.TLSConfig = &tls.Config{GetCertificate: reloader.GetCertificate}
+		cert, key = "", ""
+	}
 
 	fmt.Println("Server started   " + time.Now().Format("Mon Jan _2 15:04:05 2006"))
-	go srv.GenerateGuides()
-	log.Fatal(http.ListenAndServeTLS(":8081", cert, key, nil))
-	// log.Fatal(http.ListenAndServe(":8081", nil))
+	go srv.LoadGuides()
+	go srv.WatchIngestion(time.Minute * time.Duration(cfg.Server.IngestionPollMinutes))
+
+	serveErr := make(chan error, 1)
+	go func() {
+		fmt.Printf("listening on %s (%s)\n", addr, mode)
+		if mode == "http" {
+			serveErr <- httpServer.ListenAndServe()
+		} else {
+			serveErr <- httpServer.ListenAndServeTLS(cert, key)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	case sig := <-stop:
+		fmt.Printf("received %v, shutting down\n", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		fmt.Printf("failed to drain requests: %v\n", err)
+	}
+	if err := srv.Close(); err != nil {
+		fmt.Printf("failed to close server: %v\n", err)
+	}
+	fmt.Println("Server stopped   " + time.Now().Format("Mon Jan _2 15:04:05 2006"))
 }
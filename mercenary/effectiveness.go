@@ -0,0 +1,63 @@
+package mercenary
+
+import (
+	"database/sql"
+	"strings"
+)
+
+const upsertEffectivenessQuery = `INSERT INTO merc_effectiveness(version, mercenary, unit, wave, sent, leaked, leaked_amount) VALUES(?,?,?,?,?,?,?) ON DUPLICATE KEY UPDATE sent = sent + VALUES(sent), leaked = leaked + VALUES(leaked), leaked_amount = leaked_amount + VALUES(leaked_amount)`
+const getEffectivenessQuery = `SELECT version, mercenary, unit, wave, sent, leaked, leaked_amount FROM merc_effectiveness where version = ? and mercenary = ? and sent >= ?`
+
+// Effectiveness tracks how a mercenary did when sent against boards built
+// around a unit on a wave. Sent counts waves it was part of the send, Leaked
+// the waves it got through and LeakedAmount the gold its leaks cost.
+type Effectiveness struct {
+	Version      string
+	Mercenary    string
+	Unit         string
+	Wave         int
+	Sent         int
+	Leaked       int
+	LeakedAmount int
+}
+
+func (e *Effectiveness) Upsert(db *sql.DB) error {
+	_, err := db.Exec(upsertEffectivenessQuery, e.Version, e.Mercenary, e.Unit, e.Wave, e.Sent, e.Leaked, e.LeakedAmount)
+	return err
+}
+
+func GetEffectiveness(db *sql.DB, version string, name string, minSent int) ([]*Effectiveness, error) {
+	rows, err := db.Query(getEffectivenessQuery, version, name, minSent)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []*Effectiveness{}
+	for rows.Next() {
+		var e Effectiveness
+		err = rows.Scan(&e.Version, &e.Mercenary, &e.Unit, &e.Wave, &e.Sent, &e.Leaked, &e.LeakedAmount)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, &e)
+	}
+
+	return out, rows.Err()
+}
+
+// SentMercs splits a send hash into the distinct mercenaries in it
+func SentMercs(sends string) []string {
+	if sends == "" {
+		return nil
+	}
+	seen := make(map[string]bool)
+	out := []string{}
+	for _, m := range strings.Split(sends, ",") {
+		if !seen[m] {
+			seen[m] = true
+			out = append(out, m)
+		}
+	}
+	return out
+}
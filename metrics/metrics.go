@@ -0,0 +1,340 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+var Default = NewRegistry()
+
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.collectors[c.name()]; ok {
+		panic("metrics: duplicate metric " + c.name())
+	}
+	r.collectors[c.name()] = c
+}
+
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.collectors))
+	for n := range r.collectors {
+		names = append(names, n)
+	}
+	collectors := r.collectors
+	r.mu.Unlock()
+
+	sort.Strings(names)
+	for _, n := range names {
+		collectors[n].write(w)
+	}
+}
+
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// WriteFile writes the registry in the node exporter textfile format. The
+// file is replaced atomically so a scrape never sees a partial write.
+func (r *Registry) WriteFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	bw := bufio.NewWriter(tmp)
+	r.Write(bw)
+	if err := bw.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+type vec struct {
+	metricName string
+	help       string
+	kind       string
+	labels     []string
+	mu         sync.Mutex
+	keys       map[string][]string
+}
+
+func (v *vec) name() string {
+	return v.metricName
+}
+
+func (v *vec) key(values []string) string {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d labels, got %d", v.metricName, len(v.labels), len(values)))
+	}
+	k := strings.Join(values, "\xff")
+	if _, ok := v.keys[k]; !ok {
+		v.keys[k] = append([]string{}, values...)
+	}
+	return k
+}
+
+func (v *vec) sortedKeys() []string {
+	keys := make([]string, 0, len(v.keys))
+	for k := range v.keys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (v *vec) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.metricName, v.help, v.metricName, v.kind)
+}
+
+func (v *vec) labelString(k string, extra ...string) string {
+	pairs := []string{}
+	for i, l := range v.labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", l, v.keys[k][i]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", extra[i], extra[i+1]))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+type CounterVec struct {
+	vec
+	values map[string]float64
+}
+
+type Counter struct {
+	v   *CounterVec
+	key string
+}
+
+func NewCounter(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		vec:    vec{metricName: name, help: help, kind: "counter", labels: labels, keys: make(map[string][]string)},
+		values: make(map[string]float64),
+	}
+	Default.register(c)
+	return c
+}
+
+func (c *CounterVec) With(values ...string) Counter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	k := c.key(values)
+	if _, ok := c.values[k]; !ok {
+		c.values[k] = 0
+	}
+	return Counter{v: c, key: k}
+}
+
+func (c Counter) Inc() {
+	c.Add(1)
+}
+
+func (c Counter) Add(n float64) {
+	if n < 0 {
+		return
+	}
+	c.v.mu.Lock()
+	defer c.v.mu.Unlock()
+	c.v.values[c.key] += n
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.header(w)
+	for _, k := range c.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, c.labelString(k), formatFloat(c.values[k]))
+	}
+}
+
+type GaugeVec struct {
+	vec
+	values map[string]float64
+}
+
+type Gauge struct {
+	v   *GaugeVec
+	key string
+}
+
+func NewGauge(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{
+		vec:    vec{metricName: name, help: help, kind: "gauge", labels: labels, keys: make(map[string][]string)},
+		values: make(map[string]float64),
+	}
+	Default.register(g)
+	return g
+}
+
+func (g *GaugeVec) With(values ...string) Gauge {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	k := g.key(values)
+	if _, ok := g.values[k]; !ok {
+		g.values[k] = 0
+	}
+	return Gauge{v: g, key: k}
+}
+
+func (g Gauge) Set(n float64) {
+	g.v.mu.Lock()
+	defer g.v.mu.Unlock()
+	g.v.values[g.key] = n
+}
+
+func (g Gauge) Add(n float64) {
+	g.v.mu.Lock()
+	defer g.v.mu.Unlock()
+	g.v.values[g.key] += n
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.header(w)
+	for _, k := range g.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %s\n", g.metricName, g.labelString(k), formatFloat(g.values[k]))
+	}
+}
+
+type funcMetric struct {
+	vec
+	fn func() float64
+}
+
+// NewGaugeFunc and NewCounterFunc read their value at scrape time, which
+// suits values another component already keeps track of.
+func NewGaugeFunc(name, help string, fn func() float64) {
+	Default.register(&funcMetric{vec: vec{metricName: name, help: help, kind: "gauge"}, fn: fn})
+}
+
+func NewCounterFunc(name, help string, fn func() float64) {
+	Default.register(&funcMetric{vec: vec{metricName: name, help: help, kind: "counter"}, fn: fn})
+}
+
+func (f *funcMetric) write(w io.Writer) {
+	f.header(w)
+	fmt.Fprintf(w, "%s %s\n", f.metricName, formatFloat(f.fn()))
+}
+
+type HistogramVec struct {
+	vec
+	buckets []float64
+	values  map[string]*histogramValue
+}
+
+type histogramValue struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+type Histogram struct {
+	v   *HistogramVec
+	key string
+}
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	h := &HistogramVec{
+		vec:     vec{metricName: name, help: help, kind: "histogram", labels: labels, keys: make(map[string][]string)},
+		buckets: buckets,
+		values:  make(map[string]*histogramValue),
+	}
+	Default.register(h)
+	return h
+}
+
+func (h *HistogramVec) With(values ...string) Histogram {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	k := h.key(values)
+	if _, ok := h.values[k]; !ok {
+		h.values[k] = &histogramValue{counts: make([]uint64, len(h.buckets))}
+	}
+	return Histogram{v: h, key: k}
+}
+
+func (h Histogram) Observe(n float64) {
+	h.v.mu.Lock()
+	defer h.v.mu.Unlock()
+	hv := h.v.values[h.key]
+	for i, b := range h.v.buckets {
+		if n <= b {
+			hv.counts[i]++
+		}
+	}
+	hv.count++
+	hv.sum += n
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(w)
+	for _, k := range h.sortedKeys() {
+		hv := h.values[k]
+		for i, b := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labelString(k, "le", formatFloat(b)), hv.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labelString(k, "le", "+Inf"), hv.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, h.labelString(k), formatFloat(hv.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, h.labelString(k), hv.count)
+	}
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,9 @@
+create table if not exists guide_generation(
+    id int not null auto_increment,
+    version varchar(16) not null,
+    scorer varchar(64) not null,
+    parameters varchar(1024) not null,
+    created_at datetime not null,
+    primary key(id),
+    index version_index (version)
+);
@@ -0,0 +1,13 @@
+create table if not exists guide(
+    id int not null auto_increment,
+    generation_id int not null,
+    main_unit_id int not null,
+    secondary_unit_id int not null,
+    score int not null,
+    winrate int not null,
+    workers double not null,
+    mastermind varchar(32) not null,
+    waves mediumtext not null,
+    primary key(id),
+    CONSTRAINT fk_guide_generation_id foreign key(generation_id) references guide_generation(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
@@ -0,0 +1,4 @@
+alter table guide
+    add column mastermind_rule varchar(64) not null default '',
+    add column mastermind_reason varchar(255) not null default '',
+    add column mastermind_confidence double not null default 0;
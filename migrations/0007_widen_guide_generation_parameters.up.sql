@@ -0,0 +1 @@
+alter table guide_generation modify parameters text not null;
@@ -0,0 +1 @@
+alter table unit add column legion varchar(64) not null default '';
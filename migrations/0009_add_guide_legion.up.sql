@@ -0,0 +1 @@
+alter table guide add column legion varchar(64) not null default '';
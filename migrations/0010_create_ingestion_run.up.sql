@@ -0,0 +1,6 @@
+create table if not exists ingestion_run(
+    id int not null auto_increment,
+    started_at datetime not null,
+    finished_at datetime,
+    primary key(id)
+);
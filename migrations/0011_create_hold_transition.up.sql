@@ -0,0 +1,13 @@
+create table if not exists hold_transition(
+    id int not null auto_increment,
+    version varchar(16) not null,
+    from_unit varchar(64) not null,
+    from_wave int not null,
+    from_hash char(16) not null,
+    to_unit varchar(64) not null,
+    to_hash char(16) not null,
+    games int not null default 0,
+    won int not null default 0,
+    primary key(id),
+    unique key transition_key (version, from_unit, from_wave, from_hash, to_unit, to_hash)
+);
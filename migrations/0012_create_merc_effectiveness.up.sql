@@ -0,0 +1,12 @@
+create table if not exists merc_effectiveness(
+    id int not null auto_increment,
+    version varchar(16) not null,
+    mercenary varchar(64) not null,
+    unit varchar(64) not null,
+    wave int not null,
+    sent int not null default 0,
+    leaked int not null default 0,
+    leaked_amount int not null default 0,
+    primary key(id),
+    unique key effectiveness_key (version, mercenary, unit, wave)
+);
@@ -0,0 +1,14 @@
+create table if not exists hold_economy(
+    id int not null auto_increment,
+    version varchar(16) not null,
+    unit varchar(64) not null,
+    wave int not null,
+    position_hash char(16) not null,
+    workers int not null,
+    value_bucket int not null,
+    games int not null default 0,
+    won int not null default 0,
+    held int not null default 0,
+    primary key(id),
+    unique key economy_key (version, unit, wave, position_hash, workers, value_bucket)
+);
@@ -0,0 +1,9 @@
+create table if not exists win_model(
+    id int not null auto_increment,
+    version varchar(16) not null,
+    samples int not null,
+    coefficients text not null,
+    trained_at datetime not null,
+    primary key(id),
+    index version_index (version)
+);
@@ -0,0 +1,13 @@
+create table if not exists unit_trend(
+    id int not null auto_increment,
+    day date not null,
+    version varchar(16) not null,
+    unit varchar(64) not null,
+    wave int not null,
+    games int not null default 0,
+    won int not null default 0,
+    held int not null default 0,
+    primary key(id),
+    unique key trend_key (day, version, unit, wave),
+    index unit_index (unit, version)
+);
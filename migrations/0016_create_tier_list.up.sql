@@ -0,0 +1,12 @@
+create table if not exists tier_list(
+    id int not null auto_increment,
+    version varchar(16) not null,
+    wave_from int not null,
+    wave_to int not null,
+    bracket varchar(16) not null,
+    weights varchar(1024) not null,
+    entries mediumtext not null,
+    created_at datetime not null,
+    primary key(id),
+    index list_index (wave_from, wave_to, bracket, version)
+);
@@ -0,0 +1,10 @@
+create table if not exists player(
+    id int not null auto_increment,
+    name varchar(64) not null,
+    elo int not null default 0,
+    games int not null default 0,
+    won int not null default 0,
+    last_seen datetime not null,
+    primary key(id),
+    unique key name_key (name)
+);
@@ -0,0 +1,10 @@
+create table if not exists player_primary(
+    id int not null auto_increment,
+    name varchar(64) not null,
+    version varchar(16) not null,
+    unit varchar(64) not null,
+    games int not null default 0,
+    won int not null default 0,
+    primary key(id),
+    unique key primary_key (name, version, unit)
+);
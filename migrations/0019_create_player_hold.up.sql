@@ -0,0 +1,13 @@
+create table if not exists player_hold(
+    id int not null auto_increment,
+    name varchar(64) not null,
+    version varchar(16) not null,
+    unit varchar(64) not null,
+    wave int not null,
+    position_hash char(16) not null,
+    games int not null default 0,
+    won int not null default 0,
+    held int not null default 0,
+    primary key(id),
+    unique key hold_key (name, version, unit, wave, position_hash)
+);
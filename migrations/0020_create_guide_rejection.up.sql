@@ -0,0 +1,11 @@
+create table if not exists guide_rejection(
+    id int not null auto_increment,
+    generation_id int not null,
+    unit_pair varchar(32) not null,
+    rejected int not null,
+    filters varchar(1024) not null,
+    examples mediumtext not null,
+    primary key(id),
+    unique key rejection_key (generation_id, unit_pair),
+    CONSTRAINT fk_guide_rejection_generation_id foreign key(generation_id) references guide_generation(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
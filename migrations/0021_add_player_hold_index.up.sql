@@ -0,0 +1 @@
+alter table player_hold add index hold_index (version, unit, wave, position_hash, games);
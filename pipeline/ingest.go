@@ -0,0 +1,642 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/antonite/ltd-meta-server/db"
+	dynamicdata "github.com/antonite/ltd-meta-server/dynamic-data"
+	"github.com/antonite/ltd-meta-server/ltdapi"
+	"github.com/antonite/ltd-meta-server/mercenary"
+	playerpkg "github.com/antonite/ltd-meta-server/player"
+	"github.com/antonite/ltd-meta-server/unit"
+	"github.com/antonite/ltd-meta-server/util"
+)
+
+type analysis struct {
+	biggestUnitID  string
+	biggestUnitPos string
+	TotalValue     int
+	TotalMythium   int
+	sendHash       string
+	positionHash   string
+	position       string
+}
+
+func (p *Pipeline) Ingest(j *Job, daysAgo int) error {
+	today := time.Now().UTC().Add(time.Hour * -24 * time.Duration(daysAgo-1))
+	return p.IngestDay(j, today.Add(time.Hour*-24))
+}
+
+func (p *Pipeline) Backfill(j *Job, from time.Time, to time.Time) error {
+	run, err := dynamicdata.StartIngestionRun(p.db)
+	if err != nil {
+		return err
+	}
+
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	days := int(to.Sub(from).Hours()/24) + 1
+	j.Set("days_total", int64(days))
+	for day := from; !day.After(to); day = day.Add(time.Hour * 24) {
+		j.Logf("backfilling %s", day.Format("2006-01-02"))
+		if err := p.IngestDay(j, day); err != nil {
+			return err
+		}
+		j.Add("days_done", 1)
+	}
+
+	if err := run.Finish(p.db); err != nil {
+		return err
+	}
+	lastIngestion.With().Set(float64(time.Now().Unix()))
+	p.flushMetrics(j)
+	return nil
+}
+
+func (p *Pipeline) IngestDay(j *Job, day time.Time) error {
+	allUnits, err := unit.GetAll(p.db)
+	if err != nil {
+		return err
+	}
+
+	allMercs, err := mercenary.GetAll(p.db)
+	if err != nil {
+		return err
+	}
+
+	tables, err := db.GetTables(p.db)
+	if err != nil {
+		return err
+	}
+
+	bounties := make(map[string]int)
+	bounties["Crab"] = 6
+	bounties["Wale"] = 7
+	bounties["Hopper"] = 5
+	bounties["Flying Chicken"] = 8
+	bounties["Scorpion"] = 9
+	bounties["Scorpion King"] = 36
+	bounties["Rocko"] = 19
+	bounties["Sludge"] = 10
+	bounties["Blob"] = 2
+	bounties["Kobra"] = 11
+
+	games, errChan := p.requestDay(day)
+	processed := 0
+	timeMarker := time.Now()
+
+	// temp maps
+	holds := make(map[int]map[string]*dynamicdata.Hold)
+	sends := make(map[int]map[string]map[string]*dynamicdata.Send)
+	for i := 0; i < util.Waves; i++ {
+		holds[i] = make(map[string]*dynamicdata.Hold)
+		sends[i] = make(map[string]map[string]*dynamicdata.Send)
+	}
+	transitions := make(map[dynamicdata.HoldTransition]*dynamicdata.HoldTransition)
+	effectiveness := make(map[mercenary.Effectiveness]*mercenary.Effectiveness)
+	economy := make(map[dynamicdata.HoldEconomy]*dynamicdata.HoldEconomy)
+	trends := make(map[dynamicdata.UnitTrend]*dynamicdata.UnitTrend)
+	players := make(map[string]*playerpkg.Summary)
+	playerPrimaries := make(map[playerpkg.Primary]*playerpkg.Primary)
+	playerHolds := make(map[playerpkg.Hold]*playerpkg.Hold)
+
+	// version regex
+	reg, err := regexp.Compile("v[0-9]+.[0-9]+(.[0-9])*")
+	if err != nil {
+		return err
+	}
+
+	for g := range games {
+		processed++
+		j.Add("games_processed", 1)
+		gamesProcessed.With().Inc()
+		if processed%1000 == 0 {
+			gamesRate.With().Set(1000 / time.Since(timeMarker).Seconds())
+			timeMarker = time.Now()
+			p.flushMetrics(j)
+		}
+		if g.QueueType != "Normal" || g.EndingWave <= 1 {
+			continue
+		}
+		if !reg.MatchString(g.Version) {
+			continue
+		}
+		version := util.NormalizeVersion(g.Version)
+		for _, player := range g.PlayersData {
+			won := player.GameResult == "won"
+			// the unit the player opened with
+			opener := ""
+			// the hold this player had on the previous wave, if we tracked it
+			var prev *dynamicdata.HoldID
+			for i := 0; i < util.Min(g.EndingWave-2, util.Waves); i++ {
+				from := prev
+				prev = nil
+				if len(player.BuildPerWave[i]) == 0 {
+					continue
+				}
+
+				// find most expensive unit
+				anls, err := analyzeBoard(player, allUnits, allMercs, i)
+				if err != nil {
+					j.Logf("failed to analyze board: %v", err)
+					continue
+				}
+
+				leaked := len(player.LeaksPerWave[i]) > 0
+				if !leaked {
+					// check hydra case
+					if anls.biggestUnitID == util.Eggsack && len(player.BuildPerWave) > i+1 {
+						fullHydra := util.IsFullHydra(player.BuildPerWave[i+1], anls.biggestUnitPos)
+						// don't consider broken eggs as a hold
+						if !fullHydra {
+							leaked = true
+						}
+					}
+				}
+
+				// trends count every board, not just the units we keep holds for
+				tkey := dynamicdata.UnitTrend{Day: day.UTC(), Version: version, Unit: anls.biggestUnitID, Wave: i + 1}
+				trend, ok := trends[tkey]
+				if !ok {
+					trend = &tkey
+					trends[tkey] = trend
+				}
+				trend.Games++
+				if won {
+					trend.Won++
+				}
+				if !leaked {
+					trend.Held++
+				}
+
+				if p.cfg.Players && player.PlayerName != "" {
+					if opener == "" {
+						opener = anls.biggestUnitID
+					}
+					pkey := playerpkg.Hold{Name: player.PlayerName, Version: version, Unit: anls.biggestUnitID, Wave: i + 1, Hash: dynamicdata.HashPosition(anls.positionHash)}
+					ph, ok := playerHolds[pkey]
+					if !ok {
+						ph = &pkey
+						playerHolds[pkey] = ph
+					}
+					ph.Games++
+					if won {
+						ph.Won++
+					}
+					if !leaked {
+						ph.Held++
+					}
+				}
+
+				// check if we care about this unit
+				tn := util.GenerateUnitTableName(anls.biggestUnitID, i+1)
+				htn := tn + "_holds"
+				if !tables[htn] {
+					continue
+				}
+
+				h, ok := holds[i][anls.positionHash]
+				// skip original low elo builds
+				if !ok && player.OverallElo < p.cfg.MinElo {
+					continue
+				}
+				if !ok {
+					h = &dynamicdata.Hold{
+						PositionHash: anls.positionHash,
+						Position:     anls.position,
+						TotalValue:   anls.TotalValue,
+						VersionAdded: version,
+						BiggestUnit:  anls.biggestUnitID,
+						Player:       player.PlayerName,
+					}
+					holds[i][anls.positionHash] = h
+				}
+				if won {
+					h.Won++
+				} else {
+					h.Lost++
+				}
+				h.Workers += player.WorkersPerWave[i]
+				h.Elo += int64(player.OverallElo)
+				h.EloGames++
+
+				to := dynamicdata.NewHoldID(anls.biggestUnitID, i+1, h.VersionAdded, anls.positionHash)
+				if from != nil && from.Version == to.Version {
+					key := dynamicdata.HoldTransition{Version: to.Version, FromUnit: from.Unit, FromWave: from.Wave, FromHash: from.Hash, ToUnit: to.Unit, ToHash: to.Hash}
+					t, ok := transitions[key]
+					if !ok {
+						t = &key
+						transitions[key] = t
+					}
+					t.Games++
+					if won {
+						t.Won++
+					}
+				}
+				prev = &to
+
+				ekey := dynamicdata.HoldEconomy{Version: to.Version, Unit: to.Unit, Wave: to.Wave, PositionHash: to.Hash, Workers: player.WorkersPerWave[i], ValueBucket: dynamicdata.ValueBucket(player.ValuePerWave[i])}
+				econ, ok := economy[ekey]
+				if !ok {
+					econ = &ekey
+					economy[ekey] = econ
+				}
+				econ.Games++
+				if won {
+					econ.Won++
+				}
+				if !leaked {
+					econ.Held++
+				}
+
+				sMap, ok := sends[i][anls.positionHash]
+				if !ok {
+					sMap = make(map[string]*dynamicdata.Send)
+					sends[i][anls.positionHash] = sMap
+				}
+				s, ok := sMap[anls.sendHash]
+				if !ok {
+					s = &dynamicdata.Send{
+						Sends:        anls.sendHash,
+						TotalMythium: anls.TotalMythium,
+					}
+					sMap[anls.sendHash] = s
+				}
+				if leaked {
+					s.Leaked++
+				} else {
+					s.Held++
+				}
+
+				leakCounts := make(map[string]int)
+				for _, leak := range player.LeaksPerWave[i] {
+					leakCounts[leak]++
+					m, ok := allMercs[leak]
+					if ok {
+						s.LeakedAmount += m.IncomeBonus
+					} else {
+						m, ok := bounties[leak]
+						if ok {
+							s.LeakedAmount += m
+						}
+					}
+				}
+
+				for _, merc := range mercenary.SentMercs(anls.sendHash) {
+					key := mercenary.Effectiveness{Version: h.VersionAdded, Mercenary: merc, Unit: anls.biggestUnitID, Wave: i + 1}
+					e, ok := effectiveness[key]
+					if !ok {
+						e = &key
+						effectiveness[key] = e
+					}
+					e.Sent++
+					if n := leakCounts[merc]; n > 0 {
+						e.Leaked++
+						if m, ok := allMercs[merc]; ok {
+							e.LeakedAmount += n * m.IncomeBonus
+						}
+					}
+				}
+			}
+
+			if p.cfg.Players && player.PlayerName != "" {
+				played := gameTime(g, day)
+				ps, ok := players[player.PlayerName]
+				if !ok {
+					ps = &playerpkg.Summary{Name: player.PlayerName}
+					players[player.PlayerName] = ps
+				}
+				ps.Games++
+				if won {
+					ps.Won++
+				}
+				if !played.Before(ps.LastSeen) {
+					ps.LastSeen = played
+					ps.Elo = player.OverallElo
+				}
+
+				if opener != "" {
+					pkey := playerpkg.Primary{Name: player.PlayerName, Version: version, Unit: opener}
+					pp, ok := playerPrimaries[pkey]
+					if !ok {
+						pp = &pkey
+						playerPrimaries[pkey] = pp
+					}
+					pp.Games++
+					if won {
+						pp.Won++
+					}
+				}
+			}
+		}
+	}
+	for err := range errChan {
+		j.Logf("error in error channel: %v", err)
+		return err
+	}
+
+	holdsProcessed := 0
+	l := 0
+	for i := 0; i < util.Waves; i++ {
+		l += len(holds[i])
+	}
+	j.Add("holds_total", int64(l))
+	timeMarker = time.Now()
+
+	for i := 0; i < util.Waves; i++ {
+		for _, h := range holds[i] {
+			holdsProcessed++
+			j.Add("holds_processed", 1)
+			if holdsProcessed%100 == 0 {
+				holdsRate.With().Set(100 / time.Since(timeMarker).Seconds())
+				timeMarker = time.Now()
+				p.flushMetrics(j)
+			}
+
+			allS, ok := sends[i][h.PositionHash]
+			if !ok {
+				continue
+			}
+
+			// update hold
+			tn := util.GenerateUnitTableName(h.BiggestUnit, i+1)
+			htn := tn + "_holds"
+			dbHold, err := dynamicdata.FindHold(p.db, htn, h.PositionHash, h.VersionAdded)
+			if err != nil {
+				writeErrors.With("find_hold").Inc()
+				j.Logf("failed to find hold: %s, tn: %s, err: %v", h.PositionHash, htn, err)
+				// todo: add retries
+				continue
+			}
+			if dbHold == nil {
+				start := time.Now()
+				id, err := h.SaveHold(p.db, htn)
+				observeWrite("save_hold", start)
+				if err != nil || id == 0 {
+					writeErrors.With("save_hold").Inc()
+					j.Logf("failed to save hold: %s, tn: %s, err: %v", h.PositionHash, htn, err)
+					// todo: add retries
+					continue
+				}
+				h.ID = id
+				dbHold = h
+			} else {
+				dbHold.Won += h.Won
+				dbHold.Lost += h.Lost
+				dbHold.Workers += h.Workers
+				dbHold.Elo += h.Elo
+				dbHold.EloGames += h.EloGames
+				start := time.Now()
+				err := dbHold.UpdateHold(p.db, htn)
+				observeWrite("update_hold", start)
+				if err != nil {
+					writeErrors.With("update_hold").Inc()
+					j.Logf("failed to update hold: %s, tn: %s, err: %v", h.PositionHash, htn, err)
+					// todo: add retries
+					continue
+				}
+			}
+
+			holdsWritten.With().Inc()
+
+			// update sends
+			for _, s := range allS {
+				s.HoldsID = dbHold.ID
+				stn := tn + "_sends"
+				dbSend, err := dynamicdata.FindSend(p.db, stn, s.HoldsID, s.Sends)
+				if err != nil {
+					writeErrors.With("find_send").Inc()
+					j.Logf("failed to find send: %s, tn: %s, err: %v", s.Sends, stn, err)
+					// todo: add retries
+					continue
+				}
+				if dbSend == nil {
+					start := time.Now()
+					_, err := s.InsertSend(p.db, stn)
+					observeWrite("insert_send", start)
+					if err != nil {
+						writeErrors.With("insert_send").Inc()
+						j.Logf("failed to insert send: %s, tn: %s, err: %v", s.Sends, stn, err)
+						// todo: add retries
+						continue
+					}
+				} else {
+					dbSend.Held += s.Held
+					dbSend.Leaked += s.Leaked
+					dbSend.LeakedAmount += s.LeakedAmount
+
+					start := time.Now()
+					err := dbSend.UpdateSend(p.db, stn)
+					observeWrite("update_send", start)
+					if err != nil {
+						writeErrors.With("update_send").Inc()
+						j.Logf("failed to update send: %s, tn: %s, err: %v", s.Sends, stn, err)
+						// todo: add retries
+						continue
+					}
+				}
+			}
+		}
+	}
+
+	for _, t := range transitions {
+		start := time.Now()
+		err := t.Upsert(p.db)
+		observeWrite("upsert_transition", start)
+		if err != nil {
+			writeErrors.With("upsert_transition").Inc()
+			j.Logf("failed to save transition %s -> %s: %v", t.From(), t.To(), err)
+			continue
+		}
+		j.Add("transitions_saved", 1)
+	}
+
+	for _, e := range effectiveness {
+		start := time.Now()
+		err := e.Upsert(p.db)
+		observeWrite("upsert_merc_effectiveness", start)
+		if err != nil {
+			writeErrors.With("upsert_merc_effectiveness").Inc()
+			j.Logf("failed to save %s effectiveness against %s wave %d: %v", e.Mercenary, e.Unit, e.Wave, err)
+			continue
+		}
+		j.Add("merc_effectiveness_saved", 1)
+	}
+
+	for _, e := range economy {
+		start := time.Now()
+		err := e.Upsert(p.db)
+		observeWrite("upsert_hold_economy", start)
+		if err != nil {
+			writeErrors.With("upsert_hold_economy").Inc()
+			j.Logf("failed to save economy for %s wave %d: %v", e.Unit, e.Wave, err)
+			continue
+		}
+		j.Add("hold_economy_saved", 1)
+	}
+
+	for _, t := range trends {
+		start := time.Now()
+		err := t.Upsert(p.db)
+		observeWrite("upsert_unit_trend", start)
+		if err != nil {
+			writeErrors.With("upsert_unit_trend").Inc()
+			j.Logf("failed to save trend for %s wave %d: %v", t.Unit, t.Wave, err)
+			continue
+		}
+		j.Add("unit_trends_saved", 1)
+	}
+
+	if p.cfg.Players {
+		p.savePlayers(j, players, playerPrimaries, playerHolds)
+	}
+
+	return nil
+}
+
+func (p *Pipeline) savePlayers(j *Job, players map[string]*playerpkg.Summary, primaries map[playerpkg.Primary]*playerpkg.Primary, holds map[playerpkg.Hold]*playerpkg.Hold) {
+	summaries := make([]*playerpkg.Summary, 0, len(players))
+	for _, ps := range players {
+		summaries = append(summaries, ps)
+	}
+	start := time.Now()
+	err := playerpkg.UpsertSummaries(p.db, summaries)
+	observeWrite("upsert_player", start)
+	if err != nil {
+		writeErrors.With("upsert_player").Inc()
+		j.Logf("failed to save %d players: %v", len(summaries), err)
+	} else {
+		j.Add("players_saved", int64(len(summaries)))
+	}
+
+	prims := make([]*playerpkg.Primary, 0, len(primaries))
+	for _, pp := range primaries {
+		prims = append(prims, pp)
+	}
+	start = time.Now()
+	err = playerpkg.UpsertPrimaries(p.db, prims)
+	observeWrite("upsert_player_primary", start)
+	if err != nil {
+		writeErrors.With("upsert_player_primary").Inc()
+		j.Logf("failed to save %d player primaries: %v", len(prims), err)
+	} else {
+		j.Add("player_primaries_saved", int64(len(prims)))
+	}
+
+	hs := make([]*playerpkg.Hold, 0, len(holds))
+	for _, ph := range holds {
+		hs = append(hs, ph)
+	}
+	start = time.Now()
+	err = playerpkg.UpsertHolds(p.db, hs)
+	observeWrite("upsert_player_hold", start)
+	if err != nil {
+		writeErrors.With("upsert_player_hold").Inc()
+		j.Logf("failed to save %d player holds: %v", len(hs), err)
+	} else {
+		j.Add("player_holds_saved", int64(len(hs)))
+	}
+}
+
+// gameTime falls back to the ingested day when the api date doesn't parse
+func gameTime(g ltdapi.Game, day time.Time) time.Time {
+	if t, err := time.Parse(time.RFC3339, g.Date); err == nil {
+		return t.UTC()
+	}
+	return day.UTC()
+}
+
+// requestDay streams every game of the day from the api, both channels are
+// closed once all workers finish
+func (p *Pipeline) requestDay(day time.Time) (chan ltdapi.Game, chan error) {
+	start := day.UTC()
+	end := start.Add(time.Hour * 24)
+	dateStart := fmt.Sprintf("%d-%02d-%02d%%2000:00:00.000Z", start.Year(), start.Month(), start.Day())
+	dateEnd := fmt.Sprintf("%d-%02d-%02d%%2000:00:00.000Z", end.Year(), end.Month(), end.Day())
+	games := make(chan ltdapi.Game, 500)
+	errChan := make(chan error, 1)
+	wg := &sync.WaitGroup{}
+	for w := 0; w < p.cfg.Workers; w++ {
+		wg.Add(1)
+		go p.api.RequestGames(dateStart, dateEnd, games, errChan, wg, w, p.cfg.Workers)
+	}
+	go func(wg *sync.WaitGroup, games chan ltdapi.Game, errChan chan error) {
+		wg.Wait()
+		close(games)
+		close(errChan)
+	}(wg, games, errChan)
+	return games, errChan
+}
+
+func analyzeBoard(player ltdapi.PlayersData, allUnits map[string]*unit.Unit, allMercs map[string]*mercenary.Mercenary, index int) (analysis, error) {
+	anls := analysis{}
+	expCost := 0
+	// rehash board
+	sort.Strings(player.BuildPerWave[index])
+	// find the biggest unit
+	for _, u := range player.BuildPerWave[index] {
+		id := strings.Split(u, ":")[0]
+		existing, ok := allUnits[id]
+		if !ok {
+			return anls, errors.New(fmt.Sprintf("couldn't find unit in unit map: %s", id))
+		}
+		totVal := existing.TotalValue
+		if existing.UnitID == "nekomata_unit_id" {
+			stacks, err := strconv.Atoi(strings.Split(u, ":")[2])
+			if err != nil {
+				return anls, err
+			}
+			totVal += stacks * 30
+		}
+		if expCost < totVal {
+			expCost = totVal
+			anls.biggestUnitID = existing.UnitID
+			anls.biggestUnitPos = u
+		}
+	}
+	// hash based on the biggest unit
+	diff, err := strconv.ParseFloat(strings.Split(strings.Split(anls.biggestUnitPos, ":")[1], "|")[1], 64)
+	if err != nil {
+		return anls, err
+	}
+	for _, u := range player.BuildPerWave[index] {
+		hash, org, err := adjustUnit(u, diff, allUnits)
+		if err != nil {
+			return anls, err
+		}
+		anls.positionHash += hash + ","
+		anls.position += org + ","
+	}
+
+	anls.TotalValue += player.ValuePerWave[index]
+	anls.positionHash = strings.TrimSuffix(anls.positionHash, ",")
+	anls.position = strings.TrimSuffix(anls.position, ",")
+	if anls.biggestUnitID == "" {
+		return anls, errors.New("failed to compute most expensive unit")
+	}
+
+	sort.Strings(player.MercenariesReceivedPerWave[index])
+	anls.sendHash = strings.Join(player.MercenariesReceivedPerWave[index], ",")
+
+	return anls, nil
+}
+
+func adjustUnit(u string, diff float64, allUnits map[string]*unit.Unit) (string, string, error) {
+	build := strings.Split(u, ":")
+	pos := strings.Split(build[1], "|")
+	y, err := strconv.ParseFloat(pos[1], 64)
+	if err != nil {
+		return "", "", err
+	}
+	adjusted := math.Round((y-diff)*10) / 10
+	adjStr := fmt.Sprintf("%v:%s|%v:%s", allUnits[build[0]].ID, pos[0], adjusted, build[2])
+	orgStr := fmt.Sprintf("%v:%s:%s", allUnits[build[0]].ID, build[1], build[2])
+	return adjStr, orgStr, nil
+}
@@ -0,0 +1,229 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const maxJobLogs = 500
+const maxJobs = 100
+
+const (
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+var ErrJobRunning = errors.New("a conflicting job is already running")
+
+// mutatingKinds write ingested data. They never run next to another job, so
+// two writers can't race and readers like guides never see half written data.
+var mutatingKinds = map[string]bool{"units": true, "backfill": true, "cleanup": true}
+
+type Job struct {
+	ID         string
+	Kind       string
+	Params     map[string]string
+	Status     string
+	Error      string
+	StartedAt  time.Time
+	FinishedAt *time.Time
+	Counters   map[string]int64
+	Logs       []string
+
+	mu sync.Mutex
+}
+
+func NewJob(kind string, params map[string]string) *Job {
+	return &Job{
+		Kind:      kind,
+		Params:    params,
+		Status:    StatusRunning,
+		StartedAt: time.Now(),
+		Counters:  make(map[string]int64),
+		Logs:      []string{},
+	}
+}
+
+func (j *Job) Logf(format string, args ...interface{}) {
+	line := time.Now().Format("Mon Jan _2 15:04:05 2006") + ": " + fmt.Sprintf(format, args...)
+	fmt.Println(line)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Logs = append(j.Logs, line)
+	if len(j.Logs) > maxJobLogs {
+		j.Logs = j.Logs[len(j.Logs)-maxJobLogs:]
+	}
+}
+
+func (j *Job) Add(counter string, n int64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Counters[counter] += n
+}
+
+func (j *Job) Set(counter string, n int64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Counters[counter] = n
+}
+
+func (j *Job) Snapshot() *Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	counters := make(map[string]int64, len(j.Counters))
+	for k, v := range j.Counters {
+		counters[k] = v
+	}
+	return &Job{
+		ID:         j.ID,
+		Kind:       j.Kind,
+		Params:     j.Params,
+		Status:     j.Status,
+		Error:      j.Error,
+		StartedAt:  j.StartedAt,
+		FinishedAt: j.FinishedAt,
+		Counters:   counters,
+		Logs:       append([]string{}, j.Logs...),
+	}
+}
+
+func (j *Job) finish(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	j.FinishedAt = &now
+	if err != nil {
+		j.Status = StatusFailed
+		j.Error = err.Error()
+		return
+	}
+	j.Status = StatusSucceeded
+}
+
+type Runner struct {
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	running map[string]bool
+	nextID  int
+}
+
+func NewRunner() *Runner {
+	return &Runner{
+		jobs:    make(map[string]*Job),
+		running: make(map[string]bool),
+	}
+}
+
+func (r *Runner) Start(kind string, params map[string]string, fn func(j *Job) error) (*Job, error) {
+	r.mu.Lock()
+	if r.conflicts(kind) {
+		r.mu.Unlock()
+		return nil, ErrJobRunning
+	}
+	r.nextID++
+	j := NewJob(kind, params)
+	j.ID = strconv.Itoa(r.nextID)
+	r.jobs[j.ID] = j
+	r.running[kind] = true
+	r.prune()
+	r.mu.Unlock()
+
+	go func() {
+		var err error
+		defer func() {
+			if rec := recover(); rec != nil {
+				err = fmt.Errorf("job panicked: %v", rec)
+			}
+			if err != nil {
+				j.Logf("job %s (%s) failed: %v", j.ID, j.Kind, err)
+			} else {
+				j.Logf("job %s (%s) finished", j.ID, j.Kind)
+			}
+			j.finish(err)
+			r.mu.Lock()
+			delete(r.running, kind)
+			r.mu.Unlock()
+		}()
+		j.Logf("job %s (%s) started", j.ID, j.Kind)
+		err = fn(j)
+	}()
+
+	return j.Snapshot(), nil
+}
+
+// conflicts reports whether kind can't start next to the running jobs, caller
+// holds r.mu
+func (r *Runner) conflicts(kind string) bool {
+	if r.running[kind] {
+		return true
+	}
+	for running := range r.running {
+		if mutatingKinds[kind] || mutatingKinds[running] {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Runner) Get(id string) (*Job, bool) {
+	r.mu.Lock()
+	j, ok := r.jobs[id]
+	r.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	return j.Snapshot(), true
+}
+
+func (r *Runner) List() []*Job {
+	r.mu.Lock()
+	jobs := make([]*Job, 0, len(r.jobs))
+	for _, j := range r.jobs {
+		jobs = append(jobs, j)
+	}
+	r.mu.Unlock()
+
+	out := make([]*Job, 0, len(jobs))
+	for _, j := range jobs {
+		snap := j.Snapshot()
+		// listings stay small, logs are fetched per job
+		snap.Logs = nil
+		out = append(out, snap)
+	}
+	sort.Slice(out, func(i, k int) bool {
+		return out[i].StartedAt.After(out[k].StartedAt)
+	})
+	return out
+}
+
+// drop the oldest finished jobs once we hold too many, caller holds r.mu
+func (r *Runner) prune() {
+	if len(r.jobs) <= maxJobs {
+		return
+	}
+	finished := []*Job{}
+	for _, j := range r.jobs {
+		j.mu.Lock()
+		done := j.FinishedAt != nil
+		j.mu.Unlock()
+		if done {
+			finished = append(finished, j)
+		}
+	}
+	sort.Slice(finished, func(i, k int) bool {
+		return finished[i].StartedAt.Before(finished[k].StartedAt)
+	})
+	for _, j := range finished {
+		if len(r.jobs) <= maxJobs {
+			break
+		}
+		delete(r.jobs, j.ID)
+	}
+}
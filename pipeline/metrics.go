@@ -0,0 +1,32 @@
+package pipeline
+
+import (
+	"time"
+
+	"github.com/antonite/ltd-meta-server/metrics"
+)
+
+var (
+	gamesProcessed  = metrics.NewCounter("ltd_ingest_games_processed_total", "Games read from the LTD2 api during ingestion.")
+	gamesRate       = metrics.NewGauge("ltd_ingest_games_per_second", "Games processed per second over the last batch.")
+	holdsWritten    = metrics.NewCounter("ltd_ingest_holds_written_total", "Holds written to the database during ingestion.")
+	holdsRate       = metrics.NewGauge("ltd_ingest_holds_per_second", "Holds written per second over the last batch.")
+	writeErrors     = metrics.NewCounter("ltd_ingest_write_errors_total", "Failed database reads and writes during ingestion.", "op")
+	dbWriteDuration = metrics.NewHistogram("ltd_db_write_seconds", "Latency of ingestion database writes.", []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1}, "op")
+	lastIngestion   = metrics.NewGauge("ltd_ingest_last_success_timestamp_seconds", "Unix time the last ingestion run finished.")
+)
+
+func observeWrite(op string, start time.Time) {
+	dbWriteDuration.With(op).Observe(time.Since(start).Seconds())
+}
+
+// flushMetrics writes the metrics file when one is configured, the generator
+// has no http listener so this is how its numbers get scraped
+func (p *Pipeline) flushMetrics(j *Job) {
+	if p.cfg.MetricsFile == "" {
+		return
+	}
+	if err := metrics.Default.WriteFile(p.cfg.MetricsFile); err != nil {
+		j.Logf("failed to write metrics file %s: %v", p.cfg.MetricsFile, err)
+	}
+}
@@ -0,0 +1,168 @@
+package pipeline
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/antonite/ltd-meta-server/config"
+	"github.com/antonite/ltd-meta-server/db"
+	dynamicdata "github.com/antonite/ltd-meta-server/dynamic-data"
+	"github.com/antonite/ltd-meta-server/ltdapi"
+	"github.com/antonite/ltd-meta-server/unit"
+	"github.com/antonite/ltd-meta-server/util"
+)
+
+type Pipeline struct {
+	db  *sql.DB
+	api *ltdapi.LtdApi
+	cfg config.Generator
+}
+
+func New(database *sql.DB, api *ltdapi.LtdApi, cfg config.Generator) *Pipeline {
+	return &Pipeline{db: database, api: api, cfg: cfg}
+}
+
+// Run is the full nightly pipeline the generator binary runs.
+func (p *Pipeline) Run(j *Job, daysAgo int) error {
+	run, err := dynamicdata.StartIngestionRun(p.db)
+	if err != nil {
+		return err
+	}
+
+	j.Logf("starting unit generation")
+	if err := p.SyncUnits(j); err != nil {
+		j.Logf("failed to generate units: %v", err)
+	}
+	j.Logf("finished unit generation")
+
+	j.Logf("starting table generation")
+	if err := p.GenerateTables(j); err != nil {
+		j.Logf("failed to generate tables: %v", err)
+	}
+	j.Logf("finished table generation")
+
+	j.Logf("starting historical generation")
+	if err := p.Ingest(j, daysAgo); err != nil {
+		j.Logf("failed to generate historical: %v", err)
+	}
+	j.Logf("finished historical generation")
+
+	j.Logf("starting old data cleanup")
+	if err := p.CleanUp(j); err != nil {
+		j.Logf("failed to clean up old data: %v", err)
+	}
+	j.Logf("finished old data cleanup")
+
+	// lets running servers know there is new data
+	if err := run.Finish(p.db); err != nil {
+		return err
+	}
+	lastIngestion.With().Set(float64(time.Now().Unix()))
+	p.flushMetrics(j)
+	return nil
+}
+
+// versionedTables only serve the latest version, so CleanUp prunes them along
+// with the holds tables. tier_list and win_model keep older versions on
+// purpose, as history and as the last trained model.
+var versionedTables = []string{"hold_transition", "merc_effectiveness", "hold_economy", "unit_trend", "player_primary", "player_hold"}
+
+func (p *Pipeline) CleanUp(j *Job) error {
+	tables, err := db.GetTables(p.db)
+	if err != nil {
+		return err
+	}
+
+	versions, err := dynamicdata.GetVersions(p.db)
+	if err != nil {
+		j.Logf("%v", err)
+		return err
+	}
+	if len(versions) == 0 {
+		return nil
+	}
+
+	latest := dynamicdata.LatestVersion(versions)
+
+	for table := range tables {
+		if err := db.DeleteOldData(p.db, latest, table); err != nil {
+			return err
+		}
+		j.Add("tables_cleaned", 1)
+	}
+
+	for _, table := range versionedTables {
+		deleted, err := db.DeleteOldVersionRows(p.db, latest, table)
+		if err != nil {
+			return err
+		}
+		j.Add("tables_cleaned", 1)
+		j.Add("rows_cleaned", deleted)
+	}
+
+	return nil
+}
+
+// UpgradeTables adds the columns newer releases read to every existing holds
+// table, it has to run once after deploying a release that adds them
+func (p *Pipeline) UpgradeTables(j *Job) error {
+	pending, err := db.PendingUpgrades(p.db)
+	if err != nil {
+		return err
+	}
+	if pending == 0 {
+		j.Logf("all holds tables are up to date")
+		return nil
+	}
+	tables, err := db.GetTables(p.db)
+	if err != nil {
+		return err
+	}
+
+	j.Logf("upgrading %d holds tables", pending)
+	upgraded := 0
+	for table := range tables {
+		start := time.Now()
+		changed, err := db.UpgradeHoldsTable(p.db, table)
+		if err != nil {
+			return fmt.Errorf("failed to upgrade %s: %v", table, err)
+		}
+		j.Add("tables_checked", 1)
+		if !changed {
+			continue
+		}
+		upgraded++
+		j.Add("tables_upgraded", 1)
+		j.Logf("upgraded %s in %v (%d/%d)", table, time.Since(start).Round(time.Millisecond), upgraded, pending)
+	}
+
+	return nil
+}
+
+func (p *Pipeline) GenerateTables(j *Job) error {
+	savedUnits, err := unit.GetAll(p.db)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range savedUnits {
+		if !v.Usable {
+			continue
+		}
+		n := strings.TrimSuffix(k, "unit_id")
+		for i := 1; i <= util.Waves; i++ {
+			if i == 1 && v.TotalValue >= util.CashoutGold {
+				continue
+			}
+			tableName := fmt.Sprintf("%swave_%v", n, i)
+			if err := db.CreateTable(p.db, tableName); err != nil {
+				return err
+			}
+			j.Add("tables", 1)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package pipeline
+
+import (
+	"regexp"
+	"time"
+
+	dynamicdata "github.com/antonite/ltd-meta-server/dynamic-data"
+	"github.com/antonite/ltd-meta-server/mercenary"
+	"github.com/antonite/ltd-meta-server/predict"
+	"github.com/antonite/ltd-meta-server/unit"
+	"github.com/antonite/ltd-meta-server/util"
+)
+
+// DefaultTrainDays is how many days of games a model is trained on unless the
+// caller asks for more
+const DefaultTrainDays = 3
+
+// Train fits the win probability model on the last days of games and saves
+// it. Only games from the newest version seen are used, older patches would
+// skew the unit offsets.
+func (p *Pipeline) Train(j *Job, days int) (*predict.Model, error) {
+	allUnits, err := unit.GetAll(p.db)
+	if err != nil {
+		return nil, err
+	}
+
+	allMercs, err := mercenary.GetAll(p.db)
+	if err != nil {
+		return nil, err
+	}
+
+	reg, err := regexp.Compile("v[0-9]+.[0-9]+(.[0-9])*")
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make(map[string][]predict.Sample)
+	today := time.Now().UTC()
+	for d := days; d >= 1; d-- {
+		day := today.Add(time.Hour * -24 * time.Duration(d))
+		j.Logf("collecting samples from %s", day.Format("2006-01-02"))
+		games, errChan := p.requestDay(day)
+		for g := range games {
+			j.Add("games_processed", 1)
+			if g.QueueType != "Normal" || g.EndingWave <= 1 {
+				continue
+			}
+			if !reg.MatchString(g.Version) {
+				continue
+			}
+			version := util.NormalizeVersion(g.Version)
+			for _, player := range g.PlayersData {
+				for i := 0; i < util.Min(g.EndingWave-2, util.Waves); i++ {
+					if len(player.BuildPerWave[i]) == 0 {
+						continue
+					}
+					anls, err := analyzeBoard(player, allUnits, allMercs, i)
+					if err != nil {
+						continue
+					}
+					samples[version] = append(samples[version], predict.Sample{
+						Wave:    i + 1,
+						Value:   player.ValuePerWave[i],
+						Workers: player.WorkersPerWave[i],
+						Primary: anls.biggestUnitID,
+						Leaked:  len(player.LeaksPerWave[i]) > 0,
+						Won:     player.GameResult == "won",
+					})
+					j.Add("samples", 1)
+				}
+			}
+		}
+		for err := range errChan {
+			return nil, err
+		}
+	}
+
+	versions := make([]string, 0, len(samples))
+	for v := range samples {
+		versions = append(versions, v)
+	}
+	if len(versions) == 0 {
+		j.Logf("no games to train on")
+		return nil, nil
+	}
+	latest := dynamicdata.LatestVersion(versions)
+
+	j.Logf("training on %d samples from %s", len(samples[latest]), latest)
+	start := time.Now()
+	model := predict.Train(samples[latest], latest, predict.DefaultTrainOptions)
+	j.Logf("trained in %v", time.Since(start).Round(time.Millisecond))
+
+	if _, err := model.Save(p.db); err != nil {
+		return nil, err
+	}
+	return model, nil
+}
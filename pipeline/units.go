@@ -0,0 +1,165 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/antonite/ltd-meta-server/ltdapi"
+	"github.com/antonite/ltd-meta-server/mercenary"
+	"github.com/antonite/ltd-meta-server/unit"
+	"github.com/antonite/ltd-meta-server/util"
+)
+
+func (p *Pipeline) SyncUnits(j *Job) error {
+	version, err := p.api.GetLatestVersion()
+	if err != nil {
+		return err
+	}
+	j.Logf("syncing units for version %s", version)
+
+	savedUnits, err := unit.GetAll(p.db)
+	if err != nil {
+		return err
+	}
+	savedMercs, err := mercenary.GetAll(p.db)
+	if err != nil {
+		return err
+	}
+
+	units := make(chan ltdapi.Unit)
+	errChan := make(chan error, 1)
+	go p.api.RequestUnits(version, units, errChan)
+	// drain on early return so the request goroutine can exit
+	defer func() {
+		for range units {
+		}
+	}()
+	upgrades := make(map[string][]string)
+	for u := range units {
+		if u.CategoryClass != "Standard" && !util.IsSpecialUnit(u.UnitId) {
+			continue
+		}
+		// skip hybrid units
+		if strings.HasPrefix(u.UnitId, "hybrid") || strings.HasPrefix(u.UnitId, "test_") {
+			continue
+		}
+		switch u.UnitClass {
+		case "Mercenary":
+			if _, ok := savedMercs[u.Name]; !ok {
+				if u.MythiumCost == "" {
+					return errors.New(fmt.Sprintf("got a merc with empty myth cost: %s", u.UnitId))
+				}
+				if u.IncomeBonus == "" {
+					return errors.New(fmt.Sprintf("got a merc with empty income bonus: %s", u.UnitId))
+				}
+				cost, err := strconv.Atoi(u.MythiumCost)
+				if err != nil {
+					return err
+				}
+				inc, err := strconv.Atoi(u.IncomeBonus)
+				if err != nil {
+					return err
+				}
+				newMerc := mercenary.Mercenary{
+					ID:          u.UnitId,
+					Name:        u.Name,
+					IconPath:    u.IconPath,
+					MythiumCost: cost,
+					IncomeBonus: inc,
+					Version:     u.Version,
+				}
+				if err := newMerc.Save(p.db); err != nil {
+					return err
+				}
+				j.Add("mercs_saved", 1)
+			}
+		case "Fighter":
+			for _, upgu := range u.UpgradesFrom {
+				for _, upg := range strings.Split(upgu, " ") {
+					if upg == "units" || upg == "" || upg == " " {
+						continue
+					}
+					upgrades[upg] = append(upgrades[upg], u.UnitId)
+				}
+			}
+
+			if existing, ok := savedUnits[u.UnitId]; ok {
+				if u.LegionId != "" && existing.Legion != u.LegionId {
+					existing.Legion = u.LegionId
+					if err := existing.UpdateLegion(p.db); err != nil {
+						return err
+					}
+					j.Add("units_updated", 1)
+				}
+			} else {
+				if u.TotalValue == "" {
+					return errors.New(fmt.Sprintf("got a unit with empty total value: %s", u.UnitId))
+				}
+				val, err := strconv.Atoi(u.TotalValue)
+				if err != nil {
+					return errors.New(fmt.Sprintf("failed to convert unit total value: %s", u.UnitId))
+				}
+				if u.UnitId == "hell_raiser_buffed_unit_id" {
+					u.Name = "Hell Raiser (Tantrum)"
+				}
+				newUnit := unit.Unit{
+					UnitID:     u.UnitId,
+					Name:       u.Name,
+					IconPath:   u.IconPath,
+					TotalValue: val,
+					Usable:     true,
+					Version:    u.Version,
+					Legion:     u.LegionId,
+				}
+				if err := newUnit.Save(p.db); err != nil {
+					return err
+				}
+				j.Add("units_saved", 1)
+			}
+		}
+	}
+	for err := range errChan {
+		return err
+	}
+
+	// update upgrades
+	existingUpgrades, err := unit.GetUpgrades(p.db)
+	if err != nil {
+		return err
+	}
+	allUnits, err := unit.GetAll(p.db)
+	if err != nil {
+		return err
+	}
+	// custom upgrades
+	upgrades["eggsack_unit_id"] = append(upgrades["eggsack_unit_id"], "hydra_unit_id")
+	upgrades["hell_raiser_unit_id"] = append(upgrades["hell_raiser_unit_id"], "hell_raiser_buffed_unit_id")
+	upgrades["pack_rat_unit_id"] = append(upgrades["pack_rat_unit_id"], "pack_rat_nest_unit_id")
+
+	for k, v := range upgrades {
+		for _, upg := range v {
+			up := unit.UnitUpgrade{
+				UnitID:    allUnits[k].ID,
+				UpgradeID: allUnits[upg].ID,
+			}
+			exists := false
+			if upgrades, ok := existingUpgrades[strconv.Itoa(up.UnitID)]; ok {
+				for _, existing := range upgrades {
+					if existing == strconv.Itoa(up.UpgradeID) {
+						exists = true
+					}
+				}
+			}
+			if !exists {
+				if err = up.Save(p.db); err != nil {
+					return err
+				}
+				j.Add("upgrades_saved", 1)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package player
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// upserts are sent as multi-row inserts, %s is the list of value rows
+const upsertSummaryQuery = `INSERT INTO player(name, elo, games, won, last_seen) VALUES %s ON DUPLICATE KEY UPDATE elo = if(VALUES(last_seen) >= last_seen, VALUES(elo), elo), games = games + VALUES(games), won = won + VALUES(won), last_seen = greatest(last_seen, VALUES(last_seen))`
+const upsertPrimaryQuery = `INSERT INTO player_primary(name, version, unit, games, won) VALUES %s ON DUPLICATE KEY UPDATE games = games + VALUES(games), won = won + VALUES(won)`
+const upsertHoldQuery = `INSERT INTO player_hold(name, version, unit, wave, position_hash, games, won, held) VALUES %s ON DUPLICATE KEY UPDATE games = games + VALUES(games), won = won + VALUES(won), held = held + VALUES(held)`
+
+// batchSize keeps a single insert well under the placeholder limit
+const batchSize = 500
+const getSummaryQuery = `SELECT name, elo, games, won, last_seen FROM player where name = ?`
+const getPrimariesQuery = `SELECT name, version, unit, games, won FROM player_primary where name = ? and version = ? ORDER BY games DESC`
+const getHoldsQuery = `SELECT name, version, unit, wave, position_hash, games, won, held FROM player_hold where name = ? and version = ? ORDER BY wave, games DESC`
+const getHoldPlayersQuery = `SELECT name, version, unit, wave, position_hash, games, won, held FROM player_hold where version = ? and unit = ? and wave = ? and position_hash = ? ORDER BY games DESC LIMIT ?`
+
+// Summary is a player's record across every ingested game, Elo is from the
+// most recent one
+type Summary struct {
+	Name     string
+	Elo      int
+	Games    int
+	Won      int
+	LastSeen time.Time
+}
+
+// Primary counts the games a player opened with a unit
+type Primary struct {
+	Name    string
+	Version string
+	Unit    string
+	Games   int
+	Won     int
+}
+
+// Hold counts the games a player had a board on a wave, Hash is the same
+// short hash hold ids use
+type Hold struct {
+	Name    string
+	Version string
+	Unit    string
+	Wave    int
+	Hash    string
+	Games   int
+	Won     int
+	Held    int
+}
+
+// UpsertSummaries adds the summaries to the stored ones in a single
+// transaction, nothing is saved when any batch fails
+func UpsertSummaries(db *sql.DB, summaries []*Summary) error {
+	return upsertBatches(db, upsertSummaryQuery, "(?,?,?,?,?)", len(summaries), func(i int) []interface{} {
+		s := summaries[i]
+		return []interface{}{s.Name, s.Elo, s.Games, s.Won, s.LastSeen.UTC()}
+	})
+}
+
+func UpsertPrimaries(db *sql.DB, primaries []*Primary) error {
+	return upsertBatches(db, upsertPrimaryQuery, "(?,?,?,?,?)", len(primaries), func(i int) []interface{} {
+		p := primaries[i]
+		return []interface{}{p.Name, p.Version, p.Unit, p.Games, p.Won}
+	})
+}
+
+func UpsertHolds(db *sql.DB, holds []*Hold) error {
+	return upsertBatches(db, upsertHoldQuery, "(?,?,?,?,?,?,?,?)", len(holds), func(i int) []interface{} {
+		h := holds[i]
+		return []interface{}{h.Name, h.Version, h.Unit, h.Wave, h.Hash, h.Games, h.Won, h.Held}
+	})
+}
+
+// upsertBatches runs q once per batchSize rows inside one transaction, row
+// returns the arguments for the i-th row
+func upsertBatches(db *sql.DB, q string, placeholder string, n int, row func(i int) []interface{}) error {
+	if n == 0 {
+		return nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for start := 0; start < n; start += batchSize {
+		end := start + batchSize
+		if end > n {
+			end = n
+		}
+		rows := make([]string, 0, end-start)
+		args := []interface{}{}
+		for i := start; i < end; i++ {
+			rows = append(rows, placeholder)
+			args = append(args, row(i)...)
+		}
+		if _, err := tx.Exec(fmt.Sprintf(q, strings.Join(rows, ",")), args...); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetSummary returns nil when the player was never seen
+func GetSummary(db *sql.DB, name string) (*Summary, error) {
+	rows, err := db.Query(getSummaryQuery, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var s Summary
+	for rows.Next() {
+		err = rows.Scan(&s.Name, &s.Elo, &s.Games, &s.Won, &s.LastSeen)
+		return &s, err
+	}
+
+	return nil, rows.Err()
+}
+
+func GetPrimaries(db *sql.DB, name string, version string) ([]*Primary, error) {
+	rows, err := db.Query(getPrimariesQuery, name, version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []*Primary{}
+	for rows.Next() {
+		var p Primary
+		if err := rows.Scan(&p.Name, &p.Version, &p.Unit, &p.Games, &p.Won); err != nil {
+			return nil, err
+		}
+		out = append(out, &p)
+	}
+
+	return out, rows.Err()
+}
+
+func GetHolds(db *sql.DB, name string, version string) ([]*Hold, error) {
+	return queryHolds(db, getHoldsQuery, name, version)
+}
+
+// GetHoldPlayers returns the players who built the board most often
+func GetHoldPlayers(db *sql.DB, version string, unit string, wave int, hash string, limit int) ([]*Hold, error) {
+	return queryHolds(db, getHoldPlayersQuery, version, unit, wave, hash, limit)
+}
+
+func queryHolds(db *sql.DB, q string, args ...interface{}) ([]*Hold, error) {
+	rows, err := db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []*Hold{}
+	for rows.Next() {
+		var h Hold
+		if err := rows.Scan(&h.Name, &h.Version, &h.Unit, &h.Wave, &h.Hash, &h.Games, &h.Won, &h.Held); err != nil {
+			return nil, err
+		}
+		out = append(out, &h)
+	}
+
+	return out, rows.Err()
+}
@@ -0,0 +1,142 @@
+package predict
+
+import (
+	"math"
+	"time"
+)
+
+// Sample is one player on one wave, Won is the label
+type Sample struct {
+	Wave    int
+	Value   int
+	Workers int
+	Primary string
+	Leaked  bool
+	Won     bool
+}
+
+// Coefficients of the logistic model. Numeric features are standardised with
+// the means and deviations seen in training, each primary unit gets its own
+// offset and primaries missing from training fall back to the intercept.
+type Coefficients struct {
+	Intercept float64
+	Wave      float64
+	Value     float64
+	Workers   float64
+	Leaked    float64
+	Primaries map[string]float64
+	Means     [3]float64
+	Scales    [3]float64
+}
+
+type Model struct {
+	ID           int
+	Version      string
+	Samples      int
+	TrainedAt    time.Time
+	Coefficients Coefficients
+}
+
+func (c *Coefficients) features(s Sample) [4]float64 {
+	raw := [3]float64{float64(s.Wave), float64(s.Value), float64(s.Workers)}
+	var f [4]float64
+	for i := range raw {
+		f[i] = (raw[i] - c.Means[i]) / c.Scales[i]
+	}
+	if s.Leaked {
+		f[3] = 1
+	}
+	return f
+}
+
+func (c *Coefficients) logit(s Sample) float64 {
+	f := c.features(s)
+	return c.Intercept + c.Wave*f[0] + c.Value*f[1] + c.Workers*f[2] + c.Leaked*f[3] + c.Primaries[s.Primary]
+}
+
+// Predict returns the probability the sample's player wins the game
+func (m *Model) Predict(s Sample) float64 {
+	return sigmoid(m.Coefficients.logit(s))
+}
+
+func sigmoid(z float64) float64 {
+	return 1 / (1 + math.Exp(-z))
+}
+
+type TrainOptions struct {
+	Epochs int
+	Rate   float64
+	// L2 penalty, keeps rarely played primaries from getting extreme offsets
+	L2 float64
+}
+
+var DefaultTrainOptions = TrainOptions{Epochs: 200, Rate: 0.5, L2: 0.001}
+
+// Train fits the model with full batch gradient descent, a few days of games
+// fit in memory comfortably
+func Train(samples []Sample, version string, opts TrainOptions) *Model {
+	c := Coefficients{Primaries: make(map[string]float64)}
+	n := float64(len(samples))
+	if n == 0 {
+		c.Scales = [3]float64{1, 1, 1}
+		return &Model{Version: version, TrainedAt: time.Now().UTC(), Coefficients: c}
+	}
+
+	for _, s := range samples {
+		c.Means[0] += float64(s.Wave)
+		c.Means[1] += float64(s.Value)
+		c.Means[2] += float64(s.Workers)
+	}
+	for i := range c.Means {
+		c.Means[i] /= n
+	}
+	for _, s := range samples {
+		raw := [3]float64{float64(s.Wave), float64(s.Value), float64(s.Workers)}
+		for i := range raw {
+			d := raw[i] - c.Means[i]
+			c.Scales[i] += d * d
+		}
+	}
+	for i := range c.Scales {
+		c.Scales[i] = math.Sqrt(c.Scales[i] / n)
+		if c.Scales[i] == 0 {
+			c.Scales[i] = 1
+		}
+	}
+
+	primaryCounts := make(map[string]float64)
+	for _, s := range samples {
+		primaryCounts[s.Primary]++
+	}
+
+	for epoch := 0; epoch < opts.Epochs; epoch++ {
+		var gIntercept float64
+		var g [4]float64
+		gPrimaries := make(map[string]float64, len(primaryCounts))
+		for _, s := range samples {
+			f := c.features(s)
+			y := 0.0
+			if s.Won {
+				y = 1
+			}
+			diff := sigmoid(c.Intercept+c.Wave*f[0]+c.Value*f[1]+c.Workers*f[2]+c.Leaked*f[3]+c.Primaries[s.Primary]) - y
+			gIntercept += diff
+			for i := range f {
+				g[i] += diff * f[i]
+			}
+			gPrimaries[s.Primary] += diff
+		}
+
+		c.Intercept -= opts.Rate * gIntercept / n
+		c.Wave -= opts.Rate * (g[0]/n + opts.L2*c.Wave)
+		c.Value -= opts.Rate * (g[1]/n + opts.L2*c.Value)
+		c.Workers -= opts.Rate * (g[2]/n + opts.L2*c.Workers)
+		c.Leaked -= opts.Rate * (g[3]/n + opts.L2*c.Leaked)
+		// primaries are scaled by their own count so rare units still move
+		for p, gp := range gPrimaries {
+			c.Primaries[p] -= opts.Rate * (gp/primaryCounts[p] + opts.L2*c.Primaries[p])
+		}
+	}
+
+	return &Model{Version: version, Samples: len(samples), TrainedAt: time.Now().UTC(), Coefficients: c}
+}
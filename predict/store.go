@@ -0,0 +1,58 @@
+package predict
+
+import (
+	"database/sql"
+	"encoding/json"
+)
+
+const saveModelQuery = `INSERT INTO win_model(version, samples, coefficients, trained_at) VALUES(?,?,?,?)`
+const getLatestModelQuery = `SELECT id, version, samples, coefficients, trained_at FROM win_model ORDER BY id DESC LIMIT 1`
+const getLatestVersionModelQuery = `SELECT id, version, samples, coefficients, trained_at FROM win_model where version = ? ORDER BY id DESC LIMIT 1`
+
+func (m *Model) Save(db *sql.DB) (int, error) {
+	coefficients, err := json.Marshal(m.Coefficients)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := db.Exec(saveModelQuery, m.Version, m.Samples, string(coefficients), m.TrainedAt.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := resp.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	m.ID = int(id)
+	return m.ID, nil
+}
+
+// GetLatestModel returns the newest model, or the newest one trained on the
+// version when it is set. Returns nil when nothing has been trained.
+func GetLatestModel(db *sql.DB, version string) (*Model, error) {
+	var rows *sql.Rows
+	var err error
+	if version == "" {
+		rows, err = db.Query(getLatestModelQuery)
+	} else {
+		rows, err = db.Query(getLatestVersionModelQuery, version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	var m Model
+	var coefficients string
+	if err := rows.Scan(&m.ID, &m.Version, &m.Samples, &coefficients, &m.TrainedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(coefficients), &m.Coefficients); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/antonite/ltd-meta-server/pipeline"
+	"github.com/pkg/errors"
+)
+
+const maxBackfillDays = 31
+
+type jobRequest struct {
+	Kind string
+	From string
+	To   string
+}
+
+func (s *Server) requireAdmin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.adminToken == "" {
+			writeError(w, newError(http.StatusForbidden, codeAdminDisabled, "admin endpoints are disabled, set admin_token to enable them"))
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			writeError(w, newError(http.StatusUnauthorized, codeUnauthorized, "missing or invalid admin token"))
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (s *Server) HandleAdminJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		js, err := json.Marshal(s.jobs.List())
+		if err != nil {
+			writeError(w, internalError(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(js)
+	case http.MethodPost:
+		var req jobRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, newError(http.StatusBadRequest, codeInvalidRequest, "expected a JSON body with a job kind"))
+			return
+		}
+		job, apiErr := s.startJob(req)
+		if apiErr != nil {
+			writeError(w, apiErr)
+			return
+		}
+		js, err := json.Marshal(job)
+		if err != nil {
+			writeError(w, internalError(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/admin/jobs/"+job.ID)
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(js)
+	default:
+		writeError(w, newError(http.StatusMethodNotAllowed, codeMethodNotAllowed, "use GET or POST").with("method", r.Method))
+	}
+}
+
+func (s *Server) HandleAdminJob(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/admin/jobs/")
+	job, ok := s.jobs.Get(id)
+	if !ok {
+		writeError(w, newError(http.StatusNotFound, codeNotFound, "job not found").with("job", id))
+		return
+	}
+
+	js, err := json.Marshal(job)
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	w.Write(js)
+}
+
+func (s *Server) startJob(req jobRequest) (*pipeline.Job, *apiError) {
+	var fn func(j *pipeline.Job) error
+	params := map[string]string{}
+
+	switch req.Kind {
+	case "units":
+		fn = func(j *pipeline.Job) error {
+			if err := s.pipeline.SyncUnits(j); err != nil {
+				return err
+			}
+			if err := s.pipeline.GenerateTables(j); err != nil {
+				return err
+			}
+			return s.refreshAfterJob(j)
+		}
+	case "backfill":
+		from, err := time.Parse("2006-01-02", req.From)
+		if err != nil {
+			return nil, newError(http.StatusBadRequest, codeInvalidJob, "from must be a date like 2006-01-02").with("from", req.From)
+		}
+		to, err := time.Parse("2006-01-02", req.To)
+		if err != nil {
+			return nil, newError(http.StatusBadRequest, codeInvalidJob, "to must be a date like 2006-01-02").with("to", req.To)
+		}
+		if to.Before(from) {
+			return nil, newError(http.StatusBadRequest, codeInvalidJob, "to must not be before from").with("from", req.From).with("to", req.To)
+		}
+		if to.Sub(from) > time.Hour*24*(maxBackfillDays-1) {
+			return nil, newError(http.StatusBadRequest, codeInvalidJob, "backfills are limited to 31 days").with("from", req.From).with("to", req.To)
+		}
+		if to.After(time.Now().UTC()) {
+			return nil, newError(http.StatusBadRequest, codeInvalidJob, "to must not be in the future").with("to", req.To)
+		}
+		params["from"] = req.From
+		params["to"] = req.To
+		fn = func(j *pipeline.Job) error {
+			if err := s.pipeline.Backfill(j, from, to); err != nil {
+				return err
+			}
+			return s.refreshAfterJob(j)
+		}
+	case "cleanup":
+		fn = func(j *pipeline.Job) error {
+			if err := s.pipeline.CleanUp(j); err != nil {
+				return err
+			}
+			return s.refreshAfterJob(j)
+		}
+	case "train":
+		fn = func(j *pipeline.Job) error {
+			model, err := s.pipeline.Train(j, pipeline.DefaultTrainDays)
+			if err != nil {
+				return err
+			}
+			if model == nil {
+				return errors.New("no games found")
+			}
+			j.Set("samples", int64(model.Samples))
+			return s.refreshAfterJob(j)
+		}
+	case "guides":
+		fn = func(j *pipeline.Job) error {
+			if err := s.GenerateGuides(s.ctx); err != nil {
+				return err
+			}
+			j.Set("guides", int64(len(s.currentGuides())))
+			return nil
+		}
+	case "tiers":
+		fn = func(j *pipeline.Job) error {
+			saved, err := s.GenerateTiers(s.ctx)
+			j.Set("tier_lists", int64(saved))
+			return err
+		}
+	default:
+		return nil, newError(http.StatusBadRequest, codeInvalidJob, "kind must be one of units, backfill, cleanup, train, guides or tiers").with("kind", req.Kind)
+	}
+
+	// every job joins background before it starts so Close waits for it
+	// instead of closing the database underneath
+	if !s.track() {
+		return nil, newError(http.StatusServiceUnavailable, codeShuttingDown, "the server is shutting down")
+	}
+	run := fn
+	fn = func(j *pipeline.Job) error {
+		defer s.background.Done()
+		return run(j)
+	}
+
+	job, err := s.jobs.Start(req.Kind, params, fn)
+	if err != nil {
+		s.background.Done()
+	}
+	if err == pipeline.ErrJobRunning {
+		return nil, newError(http.StatusConflict, codeJobRunning, err.Error()).with("kind", req.Kind)
+	} else if err != nil {
+		return nil, internalError(err)
+	}
+	return job, nil
+}
+
+func (s *Server) refreshAfterJob(j *pipeline.Job) error {
+	if err := s.Reload(); err != nil {
+		return errors.Wrap(err, "failed to refresh server data")
+	}
+	dropped := s.holdsCache.Purge()
+	j.Logf("refreshed server data, dropped %d cached holds", dropped)
+	go s.warmCache()
+	return nil
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const (
+	codeInvalidRequest    = "invalid_request"
+	codeInvalidWave       = "invalid_wave"
+	codeInvalidLimit      = "invalid_limit"
+	codeInvalidPaging     = "invalid_paging"
+	codeInvalidSort       = "invalid_sort"
+	codeInvalidFields     = "invalid_fields"
+	codeInvalidHoldID     = "invalid_hold_id"
+	codeInvalidBracket    = "invalid_bracket"
+	codeInvalidVersion    = "invalid_version"
+	codeInvalidGeneration = "invalid_generation"
+	codeUnknownUnit       = "unknown_unit"
+	codeUnknownLegion     = "unknown_legion"
+	codeUnknownMerc       = "unknown_mercenary"
+	codeNotFound          = "not_found"
+	codeMethodNotAllowed  = "method_not_allowed"
+	codeUnauthorized      = "unauthorized"
+	codeAdminDisabled     = "admin_disabled"
+	codeInvalidJob        = "invalid_job"
+	codeJobRunning        = "job_running"
+	codeShuttingDown      = "shutting_down"
+	codeNoData            = "no_data"
+	codeInternal          = "internal"
+)
+
+type apiError struct {
+	Status  int                    `json:"-"`
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+func newError(status int, code string, message string) *apiError {
+	return &apiError{Status: status, Code: code, Message: message}
+}
+
+func (e *apiError) with(key string, value interface{}) *apiError {
+	if e.Details == nil {
+		e.Details = make(map[string]interface{})
+	}
+	e.Details[key] = value
+	return e
+}
+
+// internal errors are logged but never shown to clients
+func internalError(err error) *apiError {
+	fmt.Printf("internal error: %v\n", err)
+	return newError(http.StatusInternalServerError, codeInternal, "internal server error")
+}
+
+func writeError(w http.ResponseWriter, e *apiError) {
+	type envelope struct {
+		Error *apiError `json:"error"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.Status)
+	json.NewEncoder(w).Encode(envelope{Error: e})
+}
@@ -2,129 +2,332 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 
 	dynamicdata "github.com/antonite/ltd-meta-server/dynamic-data"
+	"github.com/antonite/ltd-meta-server/guide"
 	"github.com/antonite/ltd-meta-server/util"
+	"github.com/pkg/errors"
 )
 
-const cacheTimeout = 24
+const defaultHoldsLimit = 20
+const maxHoldsLimit = 50
+const maxHoldsResults = 200
+
+// guides are unpaged unless a limit is asked for
+const maxGuidesLimit = 200
+
+// sort keys for holds and guides, true when the key sorts descending by default
+var listSortKeys = map[string]bool{"score": false, "winrate": true, "value": true, "samples": true, "workers": true}
+
+const holdsMaxAge = 3600
+
+type holdsRequest struct {
+	Primary   string
+	Secondary string
+	Wave      string
+	Version   string
+	Bracket   string
+	listRequest
+}
+
+type holdsQuery struct {
+	primary   string
+	secondary string
+	wave      int
+	version   string
+	bracket   dynamicdata.Bracket
+	list      listParams
+}
 
 func (s *Server) HandleGetTopHolds(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET,HEAD,OPTIONS,POST,PUT")
-	w.Header().Set("Access-Control-Allow-Headers", "Access-Control-Allow-Headers, Origin,Accept, X-Requested-With, Content-Type, Access-Control-Request-Method, Access-Control-Request-Headers")
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
+	var sr holdsRequest
+	fromQuery := r.URL.Query().Get("primary") != ""
+	if fromQuery {
+		q := r.URL.Query()
+		sr = holdsRequest{
+			Primary:     q.Get("primary"),
+			Secondary:   q.Get("secondary"),
+			Wave:        q.Get("wave"),
+			Version:     q.Get("version"),
+			Bracket:     q.Get("bracket"),
+			listRequest: listRequestFrom(q),
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&sr); err != nil {
+		writeError(w, newError(http.StatusBadRequest, codeInvalidRequest, "expected primary, wave and version query parameters or a JSON body"))
 		return
 	}
 
-	type req struct {
-		Primary   string
-		Secondary string
-		Wave      string
-		Version   string
+	hq, apiErr := s.parseHoldsRequest(sr)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
 	}
+	s.recordHoldsRequest(hq)
 
-	var sr req
-	err := json.NewDecoder(r.Body).Decode(&sr)
+	stats, err := s.getTopHolds(hq)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, internalError(errors.Wrapf(err, "failed to get top holds for %s wave %d", hq.primary, hq.wave)))
 		return
 	}
 
-	wave, err := strconv.Atoi(sr.Wave)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if len(stats) == 0 {
+		writeError(w, newError(http.StatusNotFound, codeNoData, "no good builds found"))
 		return
 	}
+	stats = sortStats(stats, hq.list)
+
+	if fromQuery {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", holdsMaxAge))
+	}
+	writeList(w, r, page(stats, hq.list), len(stats), hq.list)
+}
 
-	if sr.Secondary != "Any" {
-		tp, ok := s.UnitMap[sr.Primary]
+// sortStats sorts a copy, the slice passed in is shared with the cache
+func sortStats(stats []*dynamicdata.Stats, lp listParams) []*dynamicdata.Stats {
+	sorted := append([]*dynamicdata.Stats{}, stats...)
+	key := func(s *dynamicdata.Stats) float64 {
+		switch lp.sort {
+		case "winrate":
+			return float64(s.Winrate)
+		case "value":
+			return float64(s.TotalValue)
+		case "samples":
+			return float64(s.Games)
+		case "workers":
+			return s.Workers
+		}
+		return float64(s.Score)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if lp.desc {
+			return key(sorted[i]) > key(sorted[j])
+		}
+		return key(sorted[i]) < key(sorted[j])
+	})
+	return sorted
+}
+
+func sortGuides(guides []guide.Guide, lp listParams) []guide.Guide {
+	sorted := append([]guide.Guide{}, guides...)
+	key := func(g guide.Guide) float64 {
+		switch lp.sort {
+		case "winrate":
+			return float64(g.Winrate)
+		case "value":
+			if len(g.Waves) == 0 {
+				return 0
+			}
+			return float64(g.Waves[len(g.Waves)-1].Value)
+		case "samples":
+			return float64(g.Games)
+		case "workers":
+			return g.Workers
+		}
+		return float64(g.Score)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if lp.desc {
+			return key(sorted[i]) > key(sorted[j])
+		}
+		return key(sorted[i]) < key(sorted[j])
+	})
+	return sorted
+}
+
+func (s *Server) parseHoldsRequest(sr holdsRequest) (holdsQuery, *apiError) {
+	hq := holdsQuery{primary: sr.Primary, secondary: sr.Secondary, version: sr.Version}
+	if hq.secondary == "" {
+		hq.secondary = "Any"
+	}
+
+	wave, err := strconv.Atoi(sr.Wave)
+	if err != nil || wave < 1 || wave > util.Waves {
+		return hq, newError(http.StatusBadRequest, codeInvalidWave, fmt.Sprintf("wave must be a number between 1 and %d", util.Waves)).with("wave", sr.Wave)
+	}
+	hq.wave = wave
+
+	lp, apiErr := parseList(sr.listRequest, listSortKeys, "score", defaultHoldsLimit, maxHoldsLimit, dynamicdata.Stats{})
+	if apiErr != nil {
+		return hq, apiErr
+	}
+	hq.list = lp
+
+	hq.bracket = dynamicdata.Brackets[0]
+	if sr.Bracket != "" {
+		b, ok := dynamicdata.FindBracket(sr.Bracket)
 		if !ok {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+			return hq, newError(http.StatusBadRequest, codeInvalidBracket, "unknown bracket").with("bracket", sr.Bracket)
 		}
-		ts, ok := s.UnitMap[sr.Secondary]
+		hq.bracket = b
+	}
+
+	units := s.unitMap()
+	tp, ok := units[hq.primary]
+	if !ok {
+		return hq, newError(http.StatusBadRequest, codeUnknownUnit, "unknown primary unit").with("primary", hq.primary)
+	}
+	if hq.secondary != "Any" {
+		ts, ok := units[hq.secondary]
 		if !ok {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+			return hq, newError(http.StatusBadRequest, codeUnknownUnit, "unknown secondary unit").with("secondary", hq.secondary)
 		}
 		if tp.TotalValue > ts.TotalValue {
-			sr.Secondary = strconv.Itoa(ts.ID)
+			hq.secondary = strconv.Itoa(ts.ID)
 		} else {
-			sr.Primary = ts.UnitID
-			sr.Secondary = strconv.Itoa(tp.ID)
+			hq.primary = ts.UnitID
+			hq.secondary = strconv.Itoa(tp.ID)
 		}
 	}
 
-	tn := util.GenerateUnitTableName(sr.Primary, wave) + "_holds"
-	if _, ok := s.Tables[tn]; !ok {
-		http.Error(w, "not even possible", http.StatusNotFound)
-		return
+	if _, ok := s.tables()[tableName(hq)]; !ok {
+		return hq, newError(http.StatusNotFound, codeNoData, "no holds are tracked for this unit on this wave").with("primary", hq.primary).with("wave", hq.wave)
 	}
 
-	if len(s.Versions) == 0 {
-		versions, err := s.GetVersions()
-		if err != nil {
-			http.Error(w, "failed to load versions", http.StatusInternalServerError)
-		}
-		s.Versions = versions
+	versions, err := s.loadVersions()
+	if err != nil {
+		return hq, internalError(err)
+	}
+	if hq.version == "" {
+		hq.version = dynamicdata.LatestVersion(versions)
 	}
-
-	// check cache
 	validVersion := false
-	for _, v := range s.Versions {
-		if v == sr.Version {
+	for _, v := range versions {
+		if v == hq.version {
 			validVersion = true
 			break
 		}
 	}
 	if !validVersion {
-		http.Error(w, "invalid version", http.StatusBadRequest)
+		return hq, newError(http.StatusBadRequest, codeInvalidVersion, "unknown version").with("version", hq.version)
+	}
+
+	return hq, nil
+}
+
+func (s *Server) getTopHolds(hq holdsQuery) ([]*dynamicdata.Stats, error) {
+	return s.holdsCache.GetOrLoad(hq.cacheKey(), func() ([]*dynamicdata.Stats, error) {
+		start := time.Now()
+		stats, err := dynamicdata.GetTopHolds(s.db, hq.primary, hq.secondary, s.allUnits().Mercs, hq.wave, hq.version, maxHoldsResults, true, 1.5, hq.bracket.MinElo)
+		topHoldsDuration.With("api").Observe(time.Since(start).Seconds())
+		return stats, err
+	})
+}
+
+func tableName(hq holdsQuery) string {
+	return util.GenerateUnitTableName(hq.primary, hq.wave) + "_holds"
+}
+
+func (hq holdsQuery) cacheKey() string {
+	return fmt.Sprintf("%s|%d|%s|%s|%s", hq.version, hq.wave, hq.primary, hq.secondary, hq.bracket.Name)
+}
+
+func (s *Server) HandleGetUnits(w http.ResponseWriter, r *http.Request) {
+	js, err := json.Marshal(s.allUnits())
+	if err != nil {
+		writeError(w, internalError(err))
 		return
 	}
 
-	if _, ok := s.Stats[sr.Version]; !ok {
-		s.Stats[sr.Version] = make(map[int]map[string]map[string]CachedStat)
+	w.Header().Set("Content-Type", "application/json")
+
+	w.Write(js)
+}
+
+func (s *Server) HandleGetVersions(w http.ResponseWriter, r *http.Request) {
+	versions, err := s.loadVersions()
+	if err != nil {
+		writeError(w, internalError(err))
+		return
 	}
 
-	if _, ok := s.Stats[sr.Version][wave]; !ok {
-		s.Stats[sr.Version][wave] = make(map[string]map[string]CachedStat)
+	js, err := json.Marshal(versions)
+	if err != nil {
+		writeError(w, internalError(err))
+		return
 	}
 
-	primary, ok := s.Stats[sr.Version][wave][sr.Primary]
-	if !ok {
-		primary = make(map[string]CachedStat)
-		s.Stats[sr.Version][wave][sr.Primary] = primary
+	w.Header().Set("Content-Type", "application/json")
+
+	w.Write(js)
+}
+
+func (s *Server) HandleGetGuides(w http.ResponseWriter, r *http.Request) {
+	lp, apiErr := parseList(listRequestFrom(r.URL.Query()), listSortKeys, "score", maxGuidesLimit, maxGuidesLimit, guide.Guide{})
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
 	}
-	var stats []*dynamicdata.Stats
-	cachedStats, ok := primary[sr.Secondary]
-	if !ok || cachedStats.exp.Before(time.Now()) {
-		stats, err = dynamicdata.GetTopHolds(s.db, sr.Primary, sr.Secondary, s.AllUnits.Mercs, wave, sr.Version, 20, true, 1.5)
+
+	guides := s.currentGuides()
+	if id := r.URL.Query().Get("generation"); id != "" {
+		gid, err := strconv.Atoi(id)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, newError(http.StatusBadRequest, codeInvalidGeneration, "generation must be a number").with("generation", id))
 			return
 		}
-		cachedStats = CachedStat{
-			stats: stats,
-			exp:   time.Now().Add(time.Hour * cacheTimeout),
+		gen, err := guide.GetGeneration(s.db, gid)
+		if err != nil {
+			writeError(w, internalError(err))
+			return
 		}
-		primary[sr.Secondary] = cachedStats
-	} else {
-		stats = cachedStats.stats
+		if gen == nil {
+			writeError(w, newError(http.StatusNotFound, codeNotFound, "generation not found").with("generation", gid))
+			return
+		}
+		guides = gen.Guides
+	} else if v := r.URL.Query().Get("version"); v != "" {
+		gen, err := guide.GetLatestVersionGeneration(s.db, v)
+		if err != nil {
+			writeError(w, internalError(err))
+			return
+		}
+		if gen == nil {
+			writeError(w, newError(http.StatusNotFound, codeNoData, "no guides for version").with("version", v))
+			return
+		}
+		guides = gen.Guides
 	}
 
-	if len(stats) == 0 {
-		http.Error(w, "no good builds found", http.StatusNotFound)
+	if legion := r.URL.Query().Get("legion"); legion != "" {
+		known := false
+		for _, u := range s.allUnits().Units {
+			if u.Legion == legion {
+				known = true
+				break
+			}
+		}
+		if !known {
+			writeError(w, newError(http.StatusBadRequest, codeUnknownLegion, "unknown legion").with("legion", legion))
+			return
+		}
+		filtered := []guide.Guide{}
+		for _, g := range guides {
+			if g.Legion == legion {
+				filtered = append(filtered, g)
+			}
+		}
+		guides = filtered
+	}
+
+	guides = sortGuides(guides, lp)
+	writeList(w, r, page(guides, lp), len(guides), lp)
+}
+
+func (s *Server) HandleGetGuideGenerations(w http.ResponseWriter, r *http.Request) {
+	gens, err := guide.GetGenerations(s.db)
+	if err != nil {
+		writeError(w, internalError(err))
 		return
 	}
 
-	js, err := json.Marshal(stats)
+	js, err := json.Marshal(gens)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, internalError(err))
 		return
 	}
 
@@ -133,47 +336,49 @@ func (s *Server) HandleGetTopHolds(w http.ResponseWriter, r *http.Request) {
 	w.Write(js)
 }
 
-func (s *Server) HandleGetUnits(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET,HEAD,OPTIONS,POST,PUT")
-	w.Header().Set("Access-Control-Allow-Headers", "Access-Control-Allow-Headers, Origin,Accept, X-Requested-With, Content-Type, Access-Control-Request-Method, Access-Control-Request-Headers")
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
+func (s *Server) HandleGetGuideDiff(w http.ResponseWriter, r *http.Request) {
+	fromID, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil {
+		writeError(w, newError(http.StatusBadRequest, codeInvalidGeneration, "from must be a generation number").with("from", r.URL.Query().Get("from")))
 		return
 	}
-
-	js, err := json.Marshal(s.AllUnits)
+	from, err := guide.GetGeneration(s.db, fromID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, internalError(err))
 		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-
-	w.Write(js)
-}
-
-func (s *Server) HandleGetVersions(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET,HEAD,OPTIONS,POST,PUT")
-	w.Header().Set("Access-Control-Allow-Headers", "Access-Control-Allow-Headers, Origin,Accept, X-Requested-With, Content-Type, Access-Control-Request-Method, Access-Control-Request-Headers")
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
+	if from == nil {
+		writeError(w, newError(http.StatusNotFound, codeNotFound, "from generation not found").with("from", fromID))
 		return
 	}
 
-	if len(s.Versions) == 0 {
-		versions, err := s.GetVersions()
+	var to *guide.Generation
+	if t := r.URL.Query().Get("to"); t != "" {
+		toID, err := strconv.Atoi(t)
+		if err != nil {
+			writeError(w, newError(http.StatusBadRequest, codeInvalidGeneration, "to must be a generation number").with("to", t))
+			return
+		}
+		to, err = guide.GetGeneration(s.db, toID)
+		if err != nil {
+			writeError(w, internalError(err))
+			return
+		}
+	} else {
+		to, err = guide.GetLatestGeneration(s.db)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, internalError(err))
 			return
 		}
-		s.Versions = versions
+	}
+	if to == nil {
+		writeError(w, newError(http.StatusNotFound, codeNotFound, "to generation not found"))
+		return
 	}
 
-	js, err := json.Marshal(s.Versions)
+	js, err := json.Marshal(guide.Compare(from, to))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, internalError(err))
 		return
 	}
 
@@ -182,18 +387,61 @@ func (s *Server) HandleGetVersions(w http.ResponseWriter, r *http.Request) {
 	w.Write(js)
 }
 
-func (s *Server) HandleGetGuides(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET,HEAD,OPTIONS,POST,PUT")
-	w.Header().Set("Access-Control-Allow-Headers", "Access-Control-Allow-Headers, Origin,Accept, X-Requested-With, Content-Type, Access-Control-Request-Method, Access-Control-Request-Headers")
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
+func (s *Server) HandleGetGuideDebug(w http.ResponseWriter, r *http.Request) {
+	type resp struct {
+		MainUnitID      int
+		SecondaryUnitID int
+		HasGuide        bool
+		Rejected        int
+		Filters         map[string]int
+		Examples        []guide.Rejection
+		Explanation     string
+	}
+
+	units := s.unitMap()
+	primary, ok := units[r.URL.Query().Get("primary")]
+	if !ok {
+		writeError(w, newError(http.StatusBadRequest, codeUnknownUnit, "unknown primary unit").with("primary", r.URL.Query().Get("primary")))
 		return
 	}
+	secondary, ok := units[r.URL.Query().Get("secondary")]
+	if !ok {
+		writeError(w, newError(http.StatusBadRequest, codeUnknownUnit, "unknown secondary unit").with("secondary", r.URL.Query().Get("secondary")))
+		return
+	}
+
+	out := resp{MainUnitID: primary.ID, SecondaryUnitID: secondary.ID, Filters: map[string]int{}, Examples: []guide.Rejection{}}
+	for _, g := range s.currentGuides() {
+		if guide.PairKey(g.MainUnitID, g.SecondaryUnitID) == guide.PairKey(primary.ID, secondary.ID) {
+			out.HasGuide = true
+			break
+		}
+	}
+
+	s.mu.RLock()
+	rejections := s.rejections
+	s.mu.RUnlock()
+
+	if pr, ok := rejections[guide.PairKey(primary.ID, secondary.ID)]; ok {
+		out.Rejected = pr.Rejected
+		out.Filters = pr.Filters
+		out.Examples = pr.Examples
+	}
+
+	switch {
+	case out.HasGuide:
+		out.Explanation = "a guide exists for this pair"
+	case rejections == nil:
+		out.Explanation = "rejections were not recorded for this generation"
+	case out.Rejected > 0:
+		out.Explanation = "every candidate for this pair was rejected by a filter"
+	default:
+		out.Explanation = "no candidate for this pair was evaluated, either no path exists or the top list filled up first"
+	}
 
-	js, err := json.Marshal(s.Guides)
+	js, err := json.Marshal(out)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, internalError(err))
 		return
 	}
 
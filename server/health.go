@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+const readyTimeout = time.Second * 2
+const startupAttempts = 8
+const startupMaxBackoff = time.Minute
+
+// BuildCommit is set at build time with
+// -ldflags "-X github.com/antonite/ltd-meta-server/server.BuildCommit=<sha>"
+var BuildCommit string
+
+type readiness struct {
+	Ready  bool
+	Checks map[string]string
+}
+
+type generationInfo struct {
+	ID        int
+	Version   string
+	CreatedAt time.Time
+	Guides    int
+}
+
+type info struct {
+	Commit          string
+	GoVersion       string
+	StartedAt       time.Time
+	GameVersion     string
+	DataVersions    []string
+	GuideGeneration *generationInfo
+}
+
+func (s *Server) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+func (s *Server) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	rd := readiness{Ready: true, Checks: make(map[string]string)}
+	fail := func(check string, reason string) {
+		rd.Ready = false
+		rd.Checks[check] = reason
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+	if err := s.db.PingContext(ctx); err != nil {
+		fail("database", err.Error())
+	} else {
+		rd.Checks["database"] = "ok"
+	}
+
+	if len(s.tables()) == 0 {
+		fail("tables", "no unit tables loaded")
+	} else {
+		rd.Checks["tables"] = "ok"
+	}
+
+	if s.currentGeneration() == nil {
+		fail("guides", "guides have not been generated yet")
+	} else {
+		rd.Checks["guides"] = "ok"
+	}
+
+	js, err := json.Marshal(rd)
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !rd.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(js)
+}
+
+func (s *Server) HandleInfo(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	in := info{
+		Commit:       buildCommit(),
+		GoVersion:    runtime.Version(),
+		StartedAt:    s.startedAt,
+		GameVersion:  s.Version,
+		DataVersions: s.Versions,
+	}
+	if s.Generation != nil {
+		in.GuideGeneration = &generationInfo{
+			ID:        s.Generation.ID,
+			Version:   s.Generation.Version,
+			CreatedAt: s.Generation.CreatedAt,
+			Guides:    len(s.Generation.Guides),
+		}
+	}
+	s.mu.RUnlock()
+
+	js, err := json.Marshal(in)
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	w.Write(js)
+}
+
+func buildCommit() string {
+	if BuildCommit != "" {
+		return BuildCommit
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	commit := "unknown"
+	dirty := false
+	for _, setting := range bi.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			commit = setting.Value
+		case "vcs.modified":
+			dirty = setting.Value == "true"
+		}
+	}
+	if dirty {
+		commit += "-dirty"
+	}
+	return commit
+}
+
+// retry runs fn until it succeeds, backing off exponentially between
+// attempts, so a database or api that is still coming up doesn't kill the boot
+func retry(name string, fn func() error) error {
+	backoff := time.Second
+	var err error
+	for i := 1; i <= startupAttempts; i++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if i == startupAttempts {
+			break
+		}
+		fmt.Printf("%s failed (attempt %d/%d), retrying in %v: %v\n", name, i, startupAttempts, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > startupMaxBackoff {
+			backoff = startupMaxBackoff
+		}
+	}
+	return fmt.Errorf("%s failed after %d attempts: %w", name, startupAttempts, err)
+}
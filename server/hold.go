@@ -0,0 +1,219 @@
+package server
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	dynamicdata "github.com/antonite/ltd-meta-server/dynamic-data"
+	"github.com/antonite/ltd-meta-server/guide"
+	"github.com/antonite/ltd-meta-server/player"
+	"github.com/antonite/ltd-meta-server/unit"
+	"github.com/antonite/ltd-meta-server/util"
+)
+
+const (
+	maxTransitions = 10
+	maxHoldPlayers = 5
+)
+
+// HandleGetHold serves /holds/{id} with the hold's sends, the players who
+// built it most and where players went next. Players are only known when the
+// generator keeps player summaries, otherwise only the first player seen with
+// the board is available.
+func (s *Server) HandleGetHold(w http.ResponseWriter, r *http.Request) {
+	raw := strings.TrimPrefix(r.URL.Path, "/holds/")
+	nextOnly := strings.HasSuffix(raw, "/next")
+	raw = strings.TrimSuffix(raw, "/next")
+	economyOnly := strings.HasSuffix(raw, "/economy")
+	raw = strings.TrimSuffix(raw, "/economy")
+	id, err := dynamicdata.ParseHoldID(raw)
+	if err != nil {
+		writeError(w, newError(http.StatusBadRequest, codeInvalidHoldID, err.Error()).with("id", raw))
+		return
+	}
+	if _, ok := s.tables()[id.TableName()+"_holds"]; !ok {
+		writeError(w, newError(http.StatusNotFound, codeNotFound, "hold not found").with("id", raw))
+		return
+	}
+
+	if economyOnly {
+		s.writeHoldEconomy(w, id)
+		return
+	}
+
+	detail, err := dynamicdata.GetHoldDetail(s.db, id, s.allUnits().Mercs)
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+	if detail == nil {
+		writeError(w, newError(http.StatusNotFound, codeNotFound, "hold not found").with("id", raw))
+		return
+	}
+
+	players, err := player.GetHoldPlayers(s.db, id.Version, id.Unit, id.Wave, id.Hash, maxHoldPlayers)
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+	for _, p := range players {
+		detail.Players = append(detail.Players, &dynamicdata.HoldPlayer{
+			Name:     p.Name,
+			Games:    p.Games,
+			Winrate:  util.Percent(p.Won, p.Games),
+			HoldRate: util.Percent(p.Held, p.Games),
+		})
+	}
+
+	detail.NextSource = "observed"
+	next, err := s.observedNextHolds(id)
+	if err == nil && len(next) == 0 && !nextOnly {
+		detail.NextSource = "inferred"
+		next, err = s.nextHolds(id, detail.PositionHash)
+	}
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+	detail.Next = next
+
+	var body interface{} = detail
+	if nextOnly {
+		body = next
+	}
+	js, err := json.Marshal(body)
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	w.Write(js)
+}
+
+// writeHoldEconomy shows how the hold did by worker count and board value
+func (s *Server) writeHoldEconomy(w http.ResponseWriter, id dynamicdata.HoldID) {
+	economy, err := dynamicdata.GetHoldEconomy(s.db, id)
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+	if economy.Games == 0 {
+		writeError(w, newError(http.StatusNotFound, codeNoData, "no economy data for this hold").with("id", id.String()))
+		return
+	}
+
+	js, err := json.Marshal(economy)
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	w.Write(js)
+}
+
+// observedNextHolds returns the boards players actually built on the next
+// wave after this hold, most common first
+func (s *Server) observedNextHolds(id dynamicdata.HoldID) ([]*dynamicdata.Transition, error) {
+	transitions, err := dynamicdata.GetTransitions(s.db, id, maxTransitions)
+	if err != nil {
+		return nil, err
+	}
+
+	next := []*dynamicdata.Transition{}
+	for _, t := range transitions {
+		to := t.To()
+		tr := &dynamicdata.Transition{ID: to.String(), Unit: to.Unit, Observed: t.Games}
+		if _, ok := s.tables()[to.TableName()+"_holds"]; ok {
+			h, err := dynamicdata.FindHoldByStableID(s.db, to)
+			if err != nil {
+				return nil, err
+			}
+			if h != nil {
+				tr.Position = h.Position
+				tr.TotalValue = h.TotalValue
+				tr.Games = h.Won + h.Lost
+				if tr.Games > 0 {
+					tr.Winrate = int(math.Floor(float64(h.Won) / float64(tr.Games) * 100))
+					tr.Workers = math.Floor(float64(h.Workers)/float64(tr.Games)*10) / 10
+				}
+			}
+		}
+		next = append(next, tr)
+	}
+	return next, nil
+}
+
+// nextHolds finds the next wave holds that build on this one, the same way
+// guides chain holds together
+func (s *Server) nextHolds(id dynamicdata.HoldID, positionHash string) ([]*dynamicdata.Transition, error) {
+	next := []*dynamicdata.Transition{}
+	if id.Wave >= util.Waves {
+		return next, nil
+	}
+
+	upgrades, err := s.GetUpgrades()
+	if err != nil {
+		return nil, err
+	}
+	all := s.allUnits()
+	specials := specialUnitIDs(all.Units)
+	tables := s.tables()
+	primary := s.unitMap()[id.Unit]
+
+	for _, u := range all.Units {
+		// same legion rule as guides, a unit whose legion isn't known yet
+		// only continues into itself
+		if primary != nil && u.UnitID != primary.UnitID && (primary.Legion == "" || u.Legion != primary.Legion) {
+			continue
+		}
+		hq := holdsQuery{primary: u.UnitID, secondary: "Any", wave: id.Wave + 1, version: id.Version, bracket: dynamicdata.Brackets[0]}
+		if _, ok := tables[tableName(hq)]; !ok {
+			continue
+		}
+		stats, err := s.getTopHolds(hq)
+		if err != nil {
+			return nil, err
+		}
+		for _, st := range stats {
+			if !guide.MatchBuildHash(positionHash, st.Hash, upgrades, specials) {
+				continue
+			}
+			next = append(next, &dynamicdata.Transition{
+				ID:         st.HoldID,
+				Unit:       u.UnitID,
+				Position:   st.Position,
+				TotalValue: st.TotalValue,
+				Games:      st.Games,
+				Winrate:    st.Winrate,
+				Workers:    st.Workers,
+			})
+		}
+	}
+
+	sort.Slice(next, func(i, j int) bool {
+		return next[i].Games > next[j].Games
+	})
+	if len(next) > maxTransitions {
+		next = next[:maxTransitions]
+	}
+	return next, nil
+}
+
+// cat and sakura keep stacks, so their hashes only match on equal stacks
+func specialUnitIDs(units []*unit.Unit) []string {
+	specials := []string{}
+	for _, u := range units {
+		if u.UnitID == "sakura_unit_id" || u.UnitID == "nekomata_unit_id" {
+			specials = append(specials, strconv.Itoa(u.ID))
+		}
+	}
+	return specials
+}
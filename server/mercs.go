@@ -0,0 +1,128 @@
+package server
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/antonite/ltd-meta-server/mercenary"
+	"github.com/antonite/ltd-meta-server/util"
+)
+
+const defaultMinSent = 10
+
+type mercEffectiveness struct {
+	Mercenary *mercenary.Mercenary
+	Version   string
+	Matchups  []effectivenessRow
+}
+
+type effectivenessRow struct {
+	Unit         string
+	Wave         int
+	Sent         int
+	Leaked       int
+	LeakedAmount int
+	// percent of sends where the merc leaked
+	LeakRate float64
+	// average gold lost to this merc per send
+	LeakedGoldPerSend float64
+}
+
+func (s *Server) HandleGetMercEffectiveness(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/mercs/")
+	name := strings.TrimSuffix(rest, "/effectiveness")
+	if name == rest || name == "" {
+		writeError(w, newError(http.StatusNotFound, codeNotFound, "no such endpoint").with("path", r.URL.Path))
+		return
+	}
+
+	merc, ok := s.allUnits().Mercs[name]
+	if !ok {
+		writeError(w, newError(http.StatusNotFound, codeUnknownMerc, "unknown mercenary").with("mercenary", name))
+		return
+	}
+
+	q := r.URL.Query()
+	version := q.Get("version")
+	if version == "" {
+		v, err := s.latestVersion()
+		if err != nil {
+			writeError(w, internalError(err))
+			return
+		}
+		version = v
+	}
+
+	unitFilter := q.Get("unit")
+	if unitFilter != "" {
+		if _, ok := s.unitMap()[unitFilter]; !ok {
+			writeError(w, newError(http.StatusBadRequest, codeUnknownUnit, "unknown unit").with("unit", unitFilter))
+			return
+		}
+	}
+
+	waveFilter := 0
+	if wq := q.Get("wave"); wq != "" {
+		wave, err := strconv.Atoi(wq)
+		if err != nil || wave < 1 || wave > util.Waves {
+			writeError(w, newError(http.StatusBadRequest, codeInvalidWave, "wave must be a number between 1 and "+strconv.Itoa(util.Waves)).with("wave", wq))
+			return
+		}
+		waveFilter = wave
+	}
+
+	minSent := defaultMinSent
+	if mq := q.Get("min_sent"); mq != "" {
+		m, err := strconv.Atoi(mq)
+		if err != nil || m < 1 {
+			writeError(w, newError(http.StatusBadRequest, codeInvalidRequest, "min_sent must be a positive number").with("min_sent", mq))
+			return
+		}
+		minSent = m
+	}
+
+	rows, err := mercenary.GetEffectiveness(s.db, version, name, minSent)
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	out := mercEffectiveness{Mercenary: merc, Version: version, Matchups: []effectivenessRow{}}
+	for _, e := range rows {
+		if unitFilter != "" && e.Unit != unitFilter {
+			continue
+		}
+		if waveFilter != 0 && e.Wave != waveFilter {
+			continue
+		}
+		out.Matchups = append(out.Matchups, effectivenessRow{
+			Unit:              e.Unit,
+			Wave:              e.Wave,
+			Sent:              e.Sent,
+			Leaked:            e.Leaked,
+			LeakedAmount:      e.LeakedAmount,
+			LeakRate:          util.Percent(e.Leaked, e.Sent),
+			LeakedGoldPerSend: math.Round(float64(e.LeakedAmount)/float64(e.Sent)*100) / 100,
+		})
+	}
+	sort.Slice(out.Matchups, func(i, j int) bool {
+		if out.Matchups[i].LeakRate != out.Matchups[j].LeakRate {
+			return out.Matchups[i].LeakRate > out.Matchups[j].LeakRate
+		}
+		return out.Matchups[i].Sent > out.Matchups[j].Sent
+	})
+
+	js, err := json.Marshal(out)
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	w.Write(js)
+}
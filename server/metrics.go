@@ -0,0 +1,58 @@
+package server
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/antonite/ltd-meta-server/cache"
+	dynamicdata "github.com/antonite/ltd-meta-server/dynamic-data"
+	"github.com/antonite/ltd-meta-server/metrics"
+)
+
+var (
+	requestsTotal           = metrics.NewCounter("ltd_http_requests_total", "HTTP requests by route, method and status code.", "route", "method", "code")
+	requestDuration         = metrics.NewHistogram("ltd_http_request_duration_seconds", "HTTP request latency by route.", nil, "route")
+	topHoldsDuration        = metrics.NewHistogram("ltd_top_holds_query_seconds", "Time spent querying top holds from the database.", nil, "caller")
+	guideGenerationDuration = metrics.NewGauge("ltd_guide_generation_duration_seconds", "Duration of the last guide generation.")
+	guideGenerationGuides   = metrics.NewGauge("ltd_guide_generation_guides", "Guides produced by the last guide generation.")
+	guideGenerationTime     = metrics.NewGauge("ltd_guide_generation_timestamp_seconds", "Unix time the last guide generation finished.")
+
+	// the cache metrics are registered once and report the holds cache of
+	// the most recently created server
+	cacheMetricsOnce sync.Once
+	metricsCache     atomic.Pointer[cache.Cache[[]*dynamicdata.Stats]]
+)
+
+func observeRequest(route string, method string, status int, start time.Time) {
+	requestsTotal.With(route, method, strconv.Itoa(status)).Inc()
+	requestDuration.With(route).Observe(time.Since(start).Seconds())
+}
+
+func (s *Server) registerMetrics() {
+	metricsCache.Store(s.holdsCache)
+	cacheMetricsOnce.Do(registerCacheMetrics)
+}
+
+func registerCacheMetrics() {
+	metrics.NewGaugeFunc("ltd_holds_cache_hit_ratio", "Share of holds cache lookups served from the cache.", func() float64 {
+		st := metricsCache.Load().Stats()
+		if st.Hits+st.Misses == 0 {
+			return 0
+		}
+		return float64(st.Hits) / float64(st.Hits+st.Misses)
+	})
+	metrics.NewCounterFunc("ltd_holds_cache_hits_total", "Holds cache hits.", func() float64 {
+		return float64(metricsCache.Load().Stats().Hits)
+	})
+	metrics.NewCounterFunc("ltd_holds_cache_misses_total", "Holds cache misses.", func() float64 {
+		return float64(metricsCache.Load().Stats().Misses)
+	})
+	metrics.NewCounterFunc("ltd_holds_cache_evictions_total", "Holds cache evictions.", func() float64 {
+		return float64(metricsCache.Load().Stats().Evictions)
+	})
+	metrics.NewGaugeFunc("ltd_holds_cache_entries", "Entries currently in the holds cache.", func() float64 {
+		return float64(metricsCache.Load().Stats().Size)
+	})
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type listRequest struct {
+	Offset string
+	Limit  string
+	Sort   string
+	Order  string
+	Fields string
+}
+
+type listParams struct {
+	offset int
+	limit  int
+	sort   string
+	desc   bool
+	fields []string
+}
+
+func listRequestFrom(q url.Values) listRequest {
+	return listRequest{
+		Offset: q.Get("offset"),
+		Limit:  q.Get("limit"),
+		Sort:   q.Get("sort"),
+		Order:  q.Get("order"),
+		Fields: q.Get("fields"),
+	}
+}
+
+// parseList validates paging, sorting and field selection. sortKeys maps the
+// accepted sort names to whether they default to descending, item is a sample
+// of the listed type used to validate the requested fields.
+func parseList(lr listRequest, sortKeys map[string]bool, defaultSort string, defaultLimit int, maxLimit int, item interface{}) (listParams, *apiError) {
+	lp := listParams{limit: defaultLimit, sort: defaultSort, desc: sortKeys[defaultSort]}
+
+	if lr.Offset != "" {
+		offset, err := strconv.Atoi(lr.Offset)
+		if err != nil || offset < 0 {
+			return lp, newError(http.StatusBadRequest, codeInvalidPaging, "offset must be a number of at least 0").with("offset", lr.Offset)
+		}
+		lp.offset = offset
+	}
+
+	if lr.Limit != "" {
+		limit, err := strconv.Atoi(lr.Limit)
+		if err != nil || limit < 1 || limit > maxLimit {
+			return lp, newError(http.StatusBadRequest, codeInvalidLimit, fmt.Sprintf("limit must be a number between 1 and %d", maxLimit)).with("limit", lr.Limit)
+		}
+		lp.limit = limit
+	}
+
+	if lr.Sort != "" {
+		desc, ok := sortKeys[lr.Sort]
+		if !ok {
+			keys := []string{}
+			for k := range sortKeys {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			return lp, newError(http.StatusBadRequest, codeInvalidSort, "unknown sort key").with("sort", lr.Sort).with("allowed", keys)
+		}
+		lp.sort = lr.Sort
+		lp.desc = desc
+	}
+
+	switch lr.Order {
+	case "":
+	case "asc":
+		lp.desc = false
+	case "desc":
+		lp.desc = true
+	default:
+		return lp, newError(http.StatusBadRequest, codeInvalidSort, "order must be asc or desc").with("order", lr.Order)
+	}
+
+	if lr.Fields != "" {
+		allowed := jsonFields(item)
+		for _, f := range strings.Split(lr.Fields, ",") {
+			f = strings.TrimSpace(f)
+			if f == "" {
+				continue
+			}
+			name, ok := allowed[strings.ToLower(f)]
+			if !ok {
+				return lp, newError(http.StatusBadRequest, codeInvalidFields, "unknown field").with("field", f)
+			}
+			lp.fields = append(lp.fields, name)
+		}
+	}
+
+	return lp, nil
+}
+
+// jsonFields returns the top level JSON keys of a struct keyed by lower case
+func jsonFields(item interface{}) map[string]string {
+	fields := make(map[string]string)
+	t := reflect.TypeOf(item)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tag := strings.Split(f.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		fields[strings.ToLower(name)] = name
+	}
+	return fields
+}
+
+// page slices out the requested page, the slice must already be sorted
+func page[T any](items []T, lp listParams) []T {
+	if lp.offset >= len(items) {
+		return []T{}
+	}
+	end := lp.offset + lp.limit
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[lp.offset:end]
+}
+
+func writeList[T any](w http.ResponseWriter, r *http.Request, items []T, total int, lp listParams) {
+	var body []byte
+	var err error
+	if len(lp.fields) == 0 {
+		body, err = json.Marshal(items)
+	} else {
+		body, err = marshalFields(items, lp.fields)
+	}
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if next := lp.offset + lp.limit; next < total && r.URL.RawQuery != "" {
+		q := r.URL.Query()
+		q.Set("offset", strconv.Itoa(next))
+		q.Set("limit", strconv.Itoa(lp.limit))
+		u := *r.URL
+		u.RawQuery = q.Encode()
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", u.RequestURI()))
+	}
+
+	w.Write(body)
+}
+
+func marshalFields[T any](items []T, fields []string) ([]byte, error) {
+	out := make([]map[string]json.RawMessage, 0, len(items))
+	for _, item := range items {
+		js, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		all := make(map[string]json.RawMessage)
+		if err := json.Unmarshal(js, &all); err != nil {
+			return nil, err
+		}
+		sparse := make(map[string]json.RawMessage, len(fields))
+		for _, f := range fields {
+			if v, ok := all[f]; ok {
+				sparse[f] = v
+			}
+		}
+		out = append(out, sparse)
+	}
+	return json.Marshal(out)
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	dynamicdata "github.com/antonite/ltd-meta-server/dynamic-data"
+	"github.com/antonite/ltd-meta-server/player"
+	"github.com/antonite/ltd-meta-server/util"
+)
+
+const (
+	defaultPlayerHolds = 5
+	maxPlayerHolds     = 20
+)
+
+type playerProfile struct {
+	Name      string
+	Elo       int
+	Games     int
+	Winrate   float64
+	LastSeen  time.Time
+	Version   string
+	Primaries []playerPrimary
+	Waves     []*playerWave
+}
+
+type playerPrimary struct {
+	Unit    string
+	Games   int
+	Winrate float64
+	// percent of the player's games in the version opened with this unit
+	Share float64
+}
+
+type playerWave struct {
+	Wave  int
+	Holds []playerHold
+}
+
+type playerHold struct {
+	ID       string
+	Unit     string
+	Games    int
+	Winrate  float64
+	HoldRate float64
+	// the same board across all tracked games, empty when it isn't tracked
+	MetaGames   int     `json:",omitempty"`
+	MetaWinrate float64 `json:",omitempty"`
+}
+
+// HandleGetPlayer serves /players/{name}, a player's record with the units
+// they open with and the boards they build each wave next to how those boards
+// do in the meta
+func (s *Server) HandleGetPlayer(w http.ResponseWriter, r *http.Request) {
+	name, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/players/"))
+	if err != nil || name == "" || strings.Contains(name, "/") {
+		writeError(w, newError(http.StatusNotFound, codeNotFound, "no such endpoint").with("path", r.URL.Path))
+		return
+	}
+
+	q := r.URL.Query()
+	holdsPerWave := defaultPlayerHolds
+	if hq := q.Get("holds_per_wave"); hq != "" {
+		n, err := strconv.Atoi(hq)
+		if err != nil || n < 1 || n > maxPlayerHolds {
+			writeError(w, newError(http.StatusBadRequest, codeInvalidLimit, "holds_per_wave must be a number between 1 and "+strconv.Itoa(maxPlayerHolds)).with("holds_per_wave", hq))
+			return
+		}
+		holdsPerWave = n
+	}
+
+	summary, err := player.GetSummary(s.db, name)
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+	if summary == nil {
+		writeError(w, newError(http.StatusNotFound, codeNotFound, "player not found").with("name", name))
+		return
+	}
+
+	version := q.Get("version")
+	if version == "" {
+		v, err := s.latestVersion()
+		if err != nil {
+			writeError(w, internalError(err))
+			return
+		}
+		version = v
+	}
+
+	primaries, err := player.GetPrimaries(s.db, name, version)
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+	holds, err := player.GetHolds(s.db, name, version)
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	out := playerProfile{
+		Name:      summary.Name,
+		Elo:       summary.Elo,
+		Games:     summary.Games,
+		Winrate:   util.Percent(summary.Won, summary.Games),
+		LastSeen:  summary.LastSeen,
+		Version:   version,
+		Primaries: []playerPrimary{},
+		Waves:     []*playerWave{},
+	}
+
+	versionGames := 0
+	for _, p := range primaries {
+		versionGames += p.Games
+	}
+	for _, p := range primaries {
+		out.Primaries = append(out.Primaries, playerPrimary{
+			Unit:    p.Unit,
+			Games:   p.Games,
+			Winrate: util.Percent(p.Won, p.Games),
+			Share:   util.Percent(p.Games, versionGames),
+		})
+	}
+
+	tables := s.tables()
+	var current *playerWave
+	for _, h := range holds {
+		if current == nil || current.Wave != h.Wave {
+			current = &playerWave{Wave: h.Wave, Holds: []playerHold{}}
+			out.Waves = append(out.Waves, current)
+		}
+		// holds come most played first within a wave
+		if len(current.Holds) >= holdsPerWave {
+			continue
+		}
+
+		id := dynamicdata.HoldID{Unit: h.Unit, Wave: h.Wave, Version: h.Version, Hash: h.Hash}
+		ph := playerHold{
+			ID:       id.String(),
+			Unit:     h.Unit,
+			Games:    h.Games,
+			Winrate:  util.Percent(h.Won, h.Games),
+			HoldRate: util.Percent(h.Held, h.Games),
+		}
+		if tables[id.TableName()+"_holds"] {
+			meta, err := dynamicdata.FindHoldByStableID(s.db, id)
+			if err != nil {
+				writeError(w, internalError(err))
+				return
+			}
+			if meta != nil {
+				ph.MetaGames = meta.Won + meta.Lost
+				ph.MetaWinrate = util.Percent(meta.Won, ph.MetaGames)
+			}
+		}
+		current.Holds = append(current.Holds, ph)
+	}
+
+	js, err := json.Marshal(out)
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	w.Write(js)
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/antonite/ltd-meta-server/predict"
+	"github.com/antonite/ltd-meta-server/util"
+)
+
+type prediction struct {
+	ModelID   int
+	Version   string
+	TrainedAt time.Time
+	Samples   int
+	// false when the model never saw the primary, the estimate then ignores it
+	PrimaryKnown bool
+	// percent chance the player wins the game
+	WinProbability float64
+}
+
+func (s *Server) HandlePredict(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	sample := predict.Sample{Primary: q.Get("primary")}
+
+	if _, ok := s.unitMap()[sample.Primary]; !ok {
+		writeError(w, newError(http.StatusBadRequest, codeUnknownUnit, "unknown primary unit").with("primary", sample.Primary))
+		return
+	}
+
+	wave, err := strconv.Atoi(q.Get("wave"))
+	if err != nil || wave < 1 || wave > util.Waves {
+		writeError(w, newError(http.StatusBadRequest, codeInvalidWave, fmt.Sprintf("wave must be a number between 1 and %d", util.Waves)).with("wave", q.Get("wave")))
+		return
+	}
+	sample.Wave = wave
+
+	value, err := strconv.Atoi(q.Get("value"))
+	if err != nil || value < 0 {
+		writeError(w, newError(http.StatusBadRequest, codeInvalidRequest, "value must be a number of at least 0").with("value", q.Get("value")))
+		return
+	}
+	sample.Value = value
+
+	workers, err := strconv.Atoi(q.Get("workers"))
+	if err != nil || workers < 0 {
+		writeError(w, newError(http.StatusBadRequest, codeInvalidRequest, "workers must be a number of at least 0").with("workers", q.Get("workers")))
+		return
+	}
+	sample.Workers = workers
+
+	if lq := q.Get("leaked"); lq != "" {
+		leaked, err := strconv.ParseBool(lq)
+		if err != nil {
+			writeError(w, newError(http.StatusBadRequest, codeInvalidRequest, "leaked must be true or false").with("leaked", lq))
+			return
+		}
+		sample.Leaked = leaked
+	}
+
+	model, err := s.latestModel(q.Get("version"))
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+	if model == nil {
+		writeError(w, newError(http.StatusNotFound, codeNoData, "no model has been trained").with("version", q.Get("version")))
+		return
+	}
+
+	_, known := model.Coefficients.Primaries[sample.Primary]
+	js, err := json.Marshal(prediction{
+		ModelID:        model.ID,
+		Version:        model.Version,
+		TrainedAt:      model.TrainedAt,
+		Samples:        model.Samples,
+		PrimaryKnown:   known,
+		WinProbability: math.Round(model.Predict(sample)*1000) / 10,
+	})
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	w.Write(js)
+}
+
+// latestModel returns the newest model trained on version, or on any version
+// when it is empty. Models are loaded once and kept until the next Reload.
+func (s *Server) latestModel(version string) (*predict.Model, error) {
+	s.mu.RLock()
+	model, ok := s.models[version]
+	s.mu.RUnlock()
+	if ok {
+		return model, nil
+	}
+
+	model, err := predict.GetLatestModel(s.db, version)
+	if err != nil || model == nil {
+		return model, err
+	}
+	s.mu.Lock()
+	s.models[version] = model
+	s.mu.Unlock()
+	return model, nil
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/antonite/ltd-meta-server/db"
+	dynamicdata "github.com/antonite/ltd-meta-server/dynamic-data"
+	"github.com/antonite/ltd-meta-server/predict"
+	"github.com/antonite/ltd-meta-server/unit"
+)
+
+const warmHolds = 25
+
+type popularHold struct {
+	primary string
+	wave    int
+}
+
+func (s *Server) Reload() error {
+	tables, err := db.GetTables(s.db)
+	if err != nil {
+		return err
+	}
+	units, err := s.GetUnits()
+	if err != nil {
+		return err
+	}
+	mercs, err := s.GetMercs()
+	if err != nil {
+		return err
+	}
+	versions, err := s.GetVersions()
+	if err != nil {
+		return err
+	}
+	model, err := predict.GetLatestModel(s.db, "")
+	if err != nil {
+		return err
+	}
+	models := make(map[string]*predict.Model)
+	if model != nil {
+		models[""] = model
+		models[model.Version] = model
+	}
+
+	ulist := []*unit.Unit{}
+	for _, u := range units {
+		ulist = append(ulist, u)
+	}
+
+	s.mu.Lock()
+	s.Tables = tables
+	s.UnitMap = units
+	s.AllUnits = CachedUnits{Units: ulist, Mercs: mercs}
+	s.Versions = versions
+	s.models = models
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *Server) WatchIngestion(interval time.Duration) {
+	if !s.track() {
+		return
+	}
+	defer s.background.Done()
+
+	lastID := 0
+	if run, err := dynamicdata.GetLatestIngestionRun(s.db); err != nil {
+		fmt.Printf("failed to check ingestion runs: %v\n", err)
+	} else if run != nil {
+		lastID = run.ID
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		run, err := dynamicdata.GetLatestIngestionRun(s.db)
+		if err != nil {
+			fmt.Printf("failed to check ingestion runs: %v\n", err)
+			continue
+		}
+		if run == nil || run.ID == lastID {
+			continue
+		}
+
+		fmt.Printf("ingestion run %d finished at %s, refreshing data\n", run.ID, run.FinishedAt.Time.Format("Mon Jan _2 15:04:05 2006"))
+		if err := s.Reload(); err != nil {
+			fmt.Printf("failed to refresh data after ingestion: %v\n", err)
+			continue
+		}
+		lastID = run.ID
+
+		dropped := s.holdsCache.Purge()
+		fmt.Printf("dropped %d cached holds\n", dropped)
+		go s.warmCache()
+	}
+}
+
+func (s *Server) recordHoldsRequest(hq holdsQuery) {
+	s.popularMu.Lock()
+	defer s.popularMu.Unlock()
+	s.popular[popularHold{primary: hq.primary, wave: hq.wave}]++
+}
+
+func (s *Server) warmCache() {
+	if !s.track() {
+		return
+	}
+	defer s.background.Done()
+
+	s.popularMu.Lock()
+	popular := make([]popularHold, 0, len(s.popular))
+	counts := make(map[popularHold]int, len(s.popular))
+	for k, v := range s.popular {
+		popular = append(popular, k)
+		counts[k] = v
+	}
+	s.popularMu.Unlock()
+
+	sort.Slice(popular, func(i, j int) bool {
+		return counts[popular[i]] > counts[popular[j]]
+	})
+	if len(popular) > warmHolds {
+		popular = popular[:warmHolds]
+	}
+
+	latest := dynamicdata.LatestVersion(s.versions())
+	if latest == "" {
+		return
+	}
+	tables := s.tables()
+
+	start := time.Now()
+	warmed := 0
+	for _, p := range popular {
+		hq := holdsQuery{
+			primary:   p.primary,
+			secondary: "Any",
+			wave:      p.wave,
+			version:   latest,
+			bracket:   dynamicdata.Brackets[0],
+		}
+		if _, ok := tables[tableName(hq)]; !ok {
+			continue
+		}
+		if _, err := s.getTopHolds(hq); err != nil {
+			fmt.Printf("failed to warm holds for %s wave %d: %v\n", p.primary, p.wave, err)
+			continue
+		}
+		warmed++
+	}
+	fmt.Printf("warmed %d popular holds in %v\n", warmed, time.Since(start).Round(time.Millisecond))
+}
+
+func (s *Server) tables() map[string]bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Tables
+}
+
+func (s *Server) versions() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Versions
+}
+
+func (s *Server) unitMap() map[string]*unit.Unit {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.UnitMap
+}
+
+func (s *Server) allUnits() CachedUnits {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.AllUnits
+}
+
+func (s *Server) latestVersion() (string, error) {
+	versions, err := s.loadVersions()
+	if err != nil {
+		return "", err
+	}
+	return dynamicdata.LatestVersion(versions), nil
+}
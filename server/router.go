@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/antonite/ltd-meta-server/metrics"
+)
+
+const defaultRouteTimeout = time.Second * 30
+const timeoutBody = `{"error":{"code":"timeout","message":"request timed out"}}`
+
+type Middleware func(http.Handler) http.Handler
+
+type Router struct {
+	mux        *http.ServeMux
+	middleware []Middleware
+	handler    http.Handler
+}
+
+type contextKey string
+
+const requestIDKey contextKey = "request_id"
+
+func NewRouter(middleware ...Middleware) *Router {
+	rt := &Router{mux: http.NewServeMux(), middleware: middleware}
+
+	// first middleware is the outermost
+	var h http.Handler = http.HandlerFunc(rt.route)
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	rt.handler = h
+
+	return rt
+}
+
+func (rt *Router) Handle(pattern string, h http.HandlerFunc, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultRouteTimeout
+	}
+	rt.mux.Handle(pattern, http.TimeoutHandler(h, timeout, timeoutBody))
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.handler.ServeHTTP(w, r)
+}
+
+func (rt *Router) route(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	h, pattern := rt.mux.Handler(r)
+	if pattern == "" {
+		writeError(rec, newError(http.StatusNotFound, codeNotFound, "no such endpoint").with("path", r.URL.Path))
+		observeRequest("unmatched", r.Method, rec.status, start)
+		return
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			observeRequest(pattern, r.Method, http.StatusInternalServerError, start)
+			panic(p)
+		}
+		observeRequest(pattern, r.Method, rec.status, start)
+	}()
+	h.ServeHTTP(rec, r)
+}
+
+func (s *Server) Routes(allowedOrigins []string, trustedProxies []*net.IPNet) http.Handler {
+	rt := NewRouter(ForwardedHeaders(trustedProxies), RequestID, Logging, Recovery, CORS(allowedOrigins))
+
+	rt.Handle("/units", s.HandleGetUnits, 0)
+	rt.Handle("/units/", s.HandleGetUnitTrend, 0)
+	rt.Handle("/holds", s.HandleGetTopHolds, time.Minute)
+	rt.Handle("/holds/", s.HandleGetHold, time.Minute)
+	rt.Handle("/versions", s.HandleGetVersions, 0)
+	rt.Handle("/mercs/", s.HandleGetMercEffectiveness, 0)
+	rt.Handle("/sends/recommend", s.HandleRecommendSends, time.Minute)
+	rt.Handle("/predict", s.HandlePredict, 0)
+	rt.Handle("/players/", s.HandleGetPlayer, 0)
+	rt.Handle("/tiers", s.HandleGetTiers, 0)
+	rt.Handle("/tiers/history", s.HandleGetTierHistory, 0)
+	rt.Handle("/guides", s.HandleGetGuides, 0)
+	rt.Handle("/guides/generations", s.HandleGetGuideGenerations, 0)
+	rt.Handle("/guides/diff", s.HandleGetGuideDiff, 0)
+	rt.Handle("/guides/debug", s.HandleGetGuideDebug, 0)
+	rt.Handle("/admin/jobs", s.requireAdmin(s.HandleAdminJobs), 0)
+	rt.Handle("/admin/jobs/", s.requireAdmin(s.HandleAdminJob), 0)
+	rt.Handle("/metrics", metrics.Default.Handler().ServeHTTP, 0)
+	rt.Handle("/healthz", s.HandleHealthz, 0)
+	rt.Handle("/readyz", s.HandleReadyz, 0)
+	rt.Handle("/info", s.HandleInfo, 0)
+
+	return rt
+}
+
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" || len(id) > 64 {
+			b := make([]byte, 8)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+func Logging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		fmt.Printf("%s [%s] %s %s %s %d %v\n", start.Format("Mon Jan _2 15:04:05 2006"), requestIDFrom(r), clientIP(r), r.Method, r.URL.RequestURI(), rec.status, time.Since(start).Round(time.Millisecond))
+	})
+}
+
+func Recovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+				fmt.Printf("[%s] panic serving %s: %v\n%s", requestIDFrom(r), r.URL.Path, rec, debug.Stack())
+				writeError(w, newError(http.StatusInternalServerError, codeInternal, "internal server error"))
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func CORS(allowedOrigins []string) Middleware {
+	allowAll := false
+	allowed := make(map[string]bool)
+	for _, o := range allowedOrigins {
+		o = strings.TrimSpace(o)
+		if o == "*" {
+			allowAll = true
+		}
+		allowed[o] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if allowAll {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else if origin != "" && allowed[origin] {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Add("Vary", "Origin")
+			}
+			w.Header().Set("Access-Control-Allow-Methods", "GET,HEAD,OPTIONS,POST,PUT")
+			w.Header().Set("Access-Control-Allow-Headers", "Access-Control-Allow-Headers, Origin,Accept, X-Requested-With, Content-Type, Access-Control-Request-Method, Access-Control-Request-Headers, Authorization, X-Request-ID")
+			w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, X-Total-Count, Link")
+			if r.Method == "OPTIONS" {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func requestIDFrom(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey).(string)
+	return id
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	dynamicdata "github.com/antonite/ltd-meta-server/dynamic-data"
+	"github.com/antonite/ltd-meta-server/util"
+)
+
+const (
+	defaultRecommendations = 10
+	maxRecommendations     = 50
+	defaultMinSendGames    = 5
+)
+
+type sendRecommendations struct {
+	Primary         string
+	Wave            int
+	Version         string
+	Value           int
+	Mythium         int
+	Recommendations []*dynamicdata.SendRecommendation
+}
+
+// HandleRecommendSends answers the attacker's question: given the opponent's
+// board, which sends leaked it most often for the mythium available.
+func (s *Server) HandleRecommendSends(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	sq := dynamicdata.SendQuery{
+		Primary:  q.Get("primary"),
+		Version:  q.Get("version"),
+		Position: q.Get("position"),
+		MinGames: defaultMinSendGames,
+		Limit:    defaultRecommendations,
+	}
+
+	if _, ok := s.unitMap()[sq.Primary]; !ok {
+		writeError(w, newError(http.StatusBadRequest, codeUnknownUnit, "unknown primary unit").with("primary", sq.Primary))
+		return
+	}
+
+	wave, err := strconv.Atoi(q.Get("wave"))
+	if err != nil || wave < 1 || wave > util.Waves {
+		writeError(w, newError(http.StatusBadRequest, codeInvalidWave, fmt.Sprintf("wave must be a number between 1 and %d", util.Waves)).with("wave", q.Get("wave")))
+		return
+	}
+	sq.Wave = wave
+
+	mythium, err := strconv.Atoi(q.Get("mythium"))
+	if err != nil || mythium < 1 {
+		writeError(w, newError(http.StatusBadRequest, codeInvalidRequest, "mythium must be a positive number").with("mythium", q.Get("mythium")))
+		return
+	}
+	sq.Mythium = mythium
+
+	if vq := q.Get("value"); vq != "" {
+		value, err := strconv.Atoi(vq)
+		if err != nil || value < 0 {
+			writeError(w, newError(http.StatusBadRequest, codeInvalidRequest, "value must be a number of at least 0").with("value", vq))
+			return
+		}
+		sq.Value = value
+	}
+
+	if mq := q.Get("min_games"); mq != "" {
+		m, err := strconv.Atoi(mq)
+		if err != nil || m < 1 {
+			writeError(w, newError(http.StatusBadRequest, codeInvalidRequest, "min_games must be a positive number").with("min_games", mq))
+			return
+		}
+		sq.MinGames = m
+	}
+
+	if lq := q.Get("limit"); lq != "" {
+		l, err := strconv.Atoi(lq)
+		if err != nil || l < 1 || l > maxRecommendations {
+			writeError(w, newError(http.StatusBadRequest, codeInvalidLimit, fmt.Sprintf("limit must be a number between 1 and %d", maxRecommendations)).with("limit", lq))
+			return
+		}
+		sq.Limit = l
+	}
+
+	if _, ok := s.tables()[util.GenerateUnitTableName(sq.Primary, sq.Wave)+"_sends"]; !ok {
+		writeError(w, newError(http.StatusNotFound, codeNoData, "no sends are tracked for this unit on this wave").with("primary", sq.Primary).with("wave", sq.Wave))
+		return
+	}
+
+	versions, err := s.loadVersions()
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+	if sq.Version == "" {
+		sq.Version = dynamicdata.LatestVersion(versions)
+	}
+	validVersion := false
+	for _, v := range versions {
+		if v == sq.Version {
+			validVersion = true
+			break
+		}
+	}
+	if !validVersion {
+		writeError(w, newError(http.StatusBadRequest, codeInvalidVersion, "unknown version").with("version", sq.Version))
+		return
+	}
+
+	recs, err := dynamicdata.RecommendSends(s.db, sq, s.allUnits().Mercs)
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	js, err := json.Marshal(sendRecommendations{
+		Primary:         sq.Primary,
+		Wave:            sq.Wave,
+		Version:         sq.Version,
+		Value:           sq.Value,
+		Mythium:         sq.Mythium,
+		Recommendations: recs,
+	})
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	w.Write(js)
+}
@@ -1,67 +1,138 @@
 package server
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/antonite/ltd-meta-server/cache"
+	"github.com/antonite/ltd-meta-server/config"
 	"github.com/antonite/ltd-meta-server/db"
 	dynamicdata "github.com/antonite/ltd-meta-server/dynamic-data"
 	"github.com/antonite/ltd-meta-server/guide"
 	"github.com/antonite/ltd-meta-server/ltdapi"
 	"github.com/antonite/ltd-meta-server/mercenary"
+	"github.com/antonite/ltd-meta-server/pipeline"
+	"github.com/antonite/ltd-meta-server/predict"
 	"github.com/antonite/ltd-meta-server/unit"
 	"github.com/antonite/ltd-meta-server/util"
+	"github.com/pkg/errors"
 )
 
-const maxGuides = 102
+const guideScorer = "wave_weighted"
 
 type Server struct {
-	db       *sql.DB
-	Api      *ltdapi.LtdApi
-	Version  string
-	AllUnits CachedUnits
-	UnitMap  map[string]*unit.Unit
-	Stats    map[string]map[int]map[string]map[string]CachedStat
-	Tables   map[string]bool
-	Versions []string
-	Guides   []guide.Guide
+	cfg        *config.Config
+	db         *sql.DB
+	Api        *ltdapi.LtdApi
+	Version    string
+	AllUnits   CachedUnits
+	UnitMap    map[string]*unit.Unit
+	Tables     map[string]bool
+	Versions   []string
+	Guides     []guide.Guide
+	Generation *guide.Generation
+
+	holdsCache      *cache.Cache[[]*dynamicdata.Stats]
+	mastermindRules []guide.MastermindRule
+	guideFilters    []guide.Filter
+	rejections      guide.Rejections
+	// latest win model per requested version, "" is the newest overall.
+	// Reload starts it over so a new model is picked up after ingestion.
+	models map[string]*predict.Model
+	mu     sync.RWMutex
+
+	popular   map[popularHold]int
+	popularMu sync.Mutex
+
+	pipeline   *pipeline.Pipeline
+	jobs       *pipeline.Runner
+	adminToken string
+	startedAt  time.Time
+
+	ctx        context.Context
+	cancel     context.CancelFunc
+	background sync.WaitGroup
+	// held while guides generate so admin runs can't overlap startup ones
+	generating sync.Mutex
 }
 
+var errGenerationRunning = errors.New("guide generation is already running")
+
 type CachedUnits struct {
 	Units []*unit.Unit
 	Mercs map[string]*mercenary.Mercenary
 }
 
-type CachedStat struct {
-	stats []*dynamicdata.Stats
-	exp   time.Time
+type guideParameters struct {
+	MaxGuides       int
+	HoldsPerWave    int
+	LeakScaler      float64
+	MastermindRules string
+	Filters         []guide.Filter
+	ObservedPaths   bool
 }
 
-func New() (*Server, error) {
-	database, err := db.New()
+func New(cfg *config.Config) (*Server, error) {
+	database, err := db.New(cfg.Database)
 	if err != nil {
 		return nil, err
 	}
+	if err := retry("database ping", database.Ping); err != nil {
+		return nil, err
+	}
 
-	api := ltdapi.New()
+	api := ltdapi.New(cfg.API.Key)
 
-	v, err := api.GetLatestVersion()
+	var v string
+	err = retry("latest version lookup", func() error {
+		v, err = api.GetLatestVersion()
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	tables, err := db.GetTables(database)
+	var tables map[string]bool
+	err = retry("table lookup", func() error {
+		tables, err = db.GetTables(database)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	stats := make(map[string]map[int]map[string]map[string]CachedStat)
+	// the holds queries read columns older tables only get from the upgrade
+	pending, err := db.PendingUpgrades(database)
+	if err != nil {
+		return nil, err
+	}
+	if pending > 0 {
+		return nil, fmt.Errorf("%d holds tables predate the current schema, run `make migrate` or `generator upgrade` first", pending)
+	}
 
-	s := &Server{db: database, Api: api, Version: v, Stats: stats, Tables: tables}
+	rules, err := guide.LoadMastermindRules(cfg.Guides.MastermindRules)
+	if err != nil {
+		return nil, err
+	}
+
+	filters, err := guide.LoadFilters(cfg.Guides.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	holdsCache := cache.New[[]*dynamicdata.Stats](cfg.Server.CacheSize, time.Hour*time.Duration(cfg.Server.CacheHours))
+
+	s := &Server{cfg: cfg, db: database, Api: api, Version: v, Tables: tables, holdsCache: holdsCache, mastermindRules: rules, guideFilters: filters, models: make(map[string]*predict.Model), popular: make(map[popularHold]int), startedAt: time.Now()}
+	s.pipeline = pipeline.New(database, api, cfg.Generator)
+	s.jobs = pipeline.NewRunner()
+	s.adminToken = cfg.Server.AdminToken
 
 	units, err := s.GetUnits()
 	if err != nil {
@@ -80,27 +151,77 @@ func New() (*Server, error) {
 	s.AllUnits = CachedUnits{Units: ulist, Mercs: mercs}
 	s.UnitMap = units
 
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.registerMetrics()
+
 	return s, nil
 }
 
-func (s *Server) GenerateGuides() {
-	fmt.Println("starting guide generation")
+func (s *Server) LoadGuides() {
+	if !s.track() {
+		return
+	}
+	defer s.background.Done()
+	// tier lists read the same tables, build them once guides are settled
+	defer s.loadTiers()
+
 	versions, err := s.GetVersions()
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
-	s.Versions = versions
+	s.setVersions(versions)
+
+	gen, err := guide.GetLatestGeneration(s.db)
+	if err != nil {
+		fmt.Printf("failed to load stored guides: %v\n", err)
+	} else if gen != nil && len(gen.Guides) > 0 && len(versions) > 0 && gen.Version == dynamicdata.LatestVersion(versions) {
+		if gen.Rejections, err = guide.GetRejections(s.db, gen.ID); err != nil {
+			fmt.Printf("failed to load guide rejections: %v\n", err)
+		}
+		s.setGeneration(gen)
+		fmt.Printf("loaded guide generation %d from %s\n", gen.ID, gen.CreatedAt.Format("Mon Jan _2 15:04:05 2006"))
+		return
+	}
+
+	if err := s.GenerateGuides(s.ctx); err != nil {
+		fmt.Printf("failed to generate guides: %v\n", err)
+	}
+}
+
+// GenerateGuides builds, stores and swaps in a new guide generation. Only one
+// runs at a time, a second caller gets errGenerationRunning.
+func (s *Server) GenerateGuides(ctx context.Context) error {
+	if !s.generating.TryLock() {
+		return errGenerationRunning
+	}
+	defer s.generating.Unlock()
+
+	fmt.Println("starting guide generation")
+	start := time.Now()
+	versions, err := s.GetVersions()
+	if err != nil {
+		return err
+	}
+	s.setVersions(versions)
+	if len(versions) == 0 {
+		return errors.New("no versions to generate guides for")
+	}
+	version := dynamicdata.LatestVersion(versions)
+	all := s.allUnits()
+	tables := s.tables()
 
 	guides := []guide.Guide{}
 	statMap := make(map[int]map[int][]*dynamicdata.Stats)
-	specials := []string{}
+	specials := specialUnitIDs(all.Units)
 	upgrades, err := s.GetUpgrades()
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
 	}
-	for _, u := range s.AllUnits.Units {
+	for _, u := range all.Units {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		viable := true
 		htnms := []string{}
 		stnms := []string{}
@@ -108,7 +229,7 @@ func (s *Server) GenerateGuides() {
 		for i := 1; i <= guide.Waves; i++ {
 			tn := util.GenerateUnitTableName(u.UnitID, i)
 			htn := tn + "_holds"
-			if _, ok := s.Tables[htn]; !ok {
+			if _, ok := tables[htn]; !ok {
 				viable = false
 				break
 			}
@@ -119,15 +240,12 @@ func (s *Server) GenerateGuides() {
 			continue
 		}
 
-		// add cat and sakura to specials for stacks
-		if u.UnitID == "sakura_unit_id" || u.UnitID == "nekomata_unit_id" {
-			specials = append(specials, strconv.Itoa(u.ID))
-		}
-
 		// find the stats for each wave
 		sMap := make(map[int][]*dynamicdata.Stats)
 		for i := 1; i <= guide.Waves; i++ {
-			stats, err := dynamicdata.GetTopHolds(s.db, u.UnitID, "Any", s.AllUnits.Mercs, i, s.Versions[0], 500, false, 3)
+			queryStart := time.Now()
+			stats, err := dynamicdata.GetTopHolds(s.db, u.UnitID, "Any", all.Mercs, i, version, s.cfg.Guides.HoldsPerWave, false, s.cfg.Guides.LeakScaler, 0)
+			topHoldsDuration.With("guides").Observe(time.Since(queryStart).Seconds())
 			if err != nil {
 				fmt.Printf("failed to generate stats for wave %d unit %s: %v\n", i, u.UnitID, err)
 				break
@@ -140,66 +258,43 @@ func (s *Server) GenerateGuides() {
 		statMap[u.ID] = sMap
 	}
 
+	var observed map[string]map[string]bool
+	if s.cfg.Guides.ObservedPaths {
+		observed, err = dynamicdata.GetVersionTransitions(s.db, version, s.cfg.Guides.MinTransitionGames)
+		if err != nil {
+			return errors.Wrap(err, "failed to load hold transitions")
+		}
+	}
+
+	legions := make(map[int]string)
+	for _, u := range all.Units {
+		legions[u.ID] = u.Legion
+	}
+
 	for uid := range statMap {
-		guides = append(guides, guide.GenerateGuides(uid, statMap, upgrades, specials)...)
+		guides = append(guides, guide.GenerateGuides(uid, statMap, upgrades, specials, legions, observed)...)
 	}
 
 	sort.Slice(guides, func(i, j int) bool {
 		return guides[i].Score < guides[j].Score
 	})
-	max := maxGuides
-	if len(guides) < max {
-		max = len(guides)
-	}
-
 	idMap := make(map[string]*unit.Unit)
-	for _, u := range s.AllUnits.Units {
+	for _, u := range all.Units {
 		idMap[strconv.Itoa(u.ID)] = u
 	}
 
-	counter := 0
+	// MaxGuides applies per legion so one legion can't crowd out the others
+	counters := make(map[string]int)
 	dupes := make(map[string]bool)
+	out := []guide.Guide{}
+	rejections := guide.Rejections{}
 	for _, g := range guides {
-		if counter >= max {
-			break
+		if counters[g.Legion] >= s.cfg.Guides.MaxGuides {
+			continue
 		}
 
 		primary, _, _ := s.getExpensiveUnits(g.Waves[0].PositionHash, idMap)
 		primaryw3, secondary, hasCheapUnit := s.getExpensiveUnits(g.Waves[2].PositionHash, idMap)
-		// skip overbuilding
-		if g.Waves[2].Value > 295 && !hasCheapUnit {
-			continue
-		}
-		// dont include any hyper aggressive leaking waves
-		skip := false
-		for _, s := range g.Waves[1].Sends {
-			if s.TotalMythium == 20 && s.LeakedRatio > 30 {
-				skip = true
-				break
-			}
-		}
-		for _, s := range g.Waves[2].Sends {
-			if s.TotalMythium == 40 && s.LeakedRatio > 30 {
-				skip = true
-				break
-			}
-		}
-		for _, s := range g.Waves[3].Sends {
-			if s.TotalMythium == 60 && s.LeakedRatio > 30 {
-				skip = true
-				break
-			}
-		}
-		for _, s := range g.Waves[4].Sends {
-			if s.TotalMythium == 80 && s.LeakedRatio > 30 {
-				skip = true
-				break
-			}
-		}
-		if skip {
-			continue
-		}
-
 		g.MainUnitID = primary
 		g.SecondaryUnitID = secondary
 		if primaryw3 != primary {
@@ -219,7 +314,11 @@ func (s *Server) GenerateGuides() {
 				break
 			}
 		}
-		if g.SecondaryUnitID == 0 {
+
+		candidate := guide.Candidate{Guide: &g, HasCheapUnit: hasCheapUnit}
+		if rej := guide.ApplyFilters(candidate, s.guideFilters); rej != nil {
+			fmt.Printf("rejected guide %d_%d (score %d) by %s: %s\n", rej.MainUnitID, rej.SecondaryUnitID, rej.Score, rej.Filter, rej.Reason)
+			rejections.Add(*rej)
 			continue
 		}
 
@@ -230,24 +329,120 @@ func (s *Server) GenerateGuides() {
 		}
 
 		// figure out mastermind option
-		g.Mastermind = "Greed"
-		if len(g.Waves[0].Sends) > 0 && g.Waves[0].Sends[0].Held == 0 && len(g.Waves[1].Sends) > 0 && g.Waves[1].Sends[0].Held == 0 {
-			g.Mastermind = "Fiesta"
-		} else if g.Waves[0].Value > 250 {
-			g.Mastermind = "Cashout"
-		} else if g.Waves[2].Value >= 285 && !hasCheapUnit {
-			g.Mastermind = "Cashout/Yolo"
-		} else if g.Waves[2].Value >= 290 && !hasCheapUnit {
-			g.Mastermind = "Cashout/Cartel"
-		}
+		guide.ClassifyMastermind(candidate, s.mastermindRules)
 
 		dupes[id] = true
-		counter++
-		s.Guides = append(s.Guides, g)
+		counters[g.Legion]++
+		out = append(out, g)
+	}
+
+	params, err := json.Marshal(guideParameters{
+		MaxGuides:       s.cfg.Guides.MaxGuides,
+		HoldsPerWave:    s.cfg.Guides.HoldsPerWave,
+		LeakScaler:      s.cfg.Guides.LeakScaler,
+		MastermindRules: s.mastermindRulesName(),
+		Filters:         s.guideFilters,
+		ObservedPaths:   s.cfg.Guides.ObservedPaths,
+	})
+	if err != nil {
+		return err
+	}
+	gen := &guide.Generation{
+		Version:    version,
+		Scorer:     guideScorer,
+		Parameters: params,
+		CreatedAt:  time.Now(),
+		Guides:     out,
+		Rejections: rejections,
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
+	// keep serving the previous guides rather than an empty set
+	if len(out) == 0 {
+		return errors.New("guide generation produced no guides, keeping the current generation")
+	}
+	if _, err := gen.Save(s.db); err != nil {
+		fmt.Printf("failed to save guide generation: %v\n", err)
+	}
+	s.setGeneration(gen)
 
+	guideGenerationDuration.With().Set(time.Since(start).Seconds())
+	guideGenerationGuides.With().Set(float64(len(out)))
+	guideGenerationTime.With().Set(float64(time.Now().Unix()))
 	fmt.Println("finished guide generation")
-	return
+	return nil
+}
+
+// Close cancels background work such as guide generation, waits for it to
+// stop and closes the database.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.cancel()
+	s.mu.Unlock()
+	s.background.Wait()
+	return s.db.Close()
+}
+
+// track adds a background task for Close to wait on, false once the server is
+// shutting down. Checking and adding under mu keeps Add from racing Wait.
+func (s *Server) track() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx.Err() != nil {
+		return false
+	}
+	s.background.Add(1)
+	return true
+}
+
+func (s *Server) mastermindRulesName() string {
+	if p := s.cfg.Guides.MastermindRules; p != "" {
+		return p
+	}
+	return "default"
+}
+
+func (s *Server) setVersions(versions []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Versions = versions
+}
+
+func (s *Server) loadVersions() ([]string, error) {
+	if versions := s.versions(); len(versions) > 0 {
+		return versions, nil
+	}
+	versions, err := s.GetVersions()
+	if err != nil {
+		return nil, err
+	}
+	s.setVersions(versions)
+	return versions, nil
+}
+
+func (s *Server) setGeneration(gen *guide.Generation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Generation = gen
+	s.Guides = gen.Guides
+	s.rejections = gen.Rejections
+}
+
+func (s *Server) currentGeneration() *guide.Generation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Generation
+}
+
+func (s *Server) currentGuides() []guide.Guide {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Guides
+}
+
+func (s *Server) CacheStats() cache.Stats {
+	return s.holdsCache.Stats()
 }
 
 func (s *Server) RefreshTables() error {
@@ -256,7 +451,9 @@ func (s *Server) RefreshTables() error {
 		return err
 	}
 
+	s.mu.Lock()
 	s.Tables = tables
+	s.mu.Unlock()
 	return nil
 }
 
@@ -268,6 +465,10 @@ func (s *Server) SaveUnit(u *unit.Unit) error {
 	return u.Save(s.db)
 }
 
+func (s *Server) UpdateUnitLegion(u *unit.Unit) error {
+	return u.UpdateLegion(s.db)
+}
+
 func (s *Server) GetUpgrades() (map[string][]string, error) {
 	return unit.GetUpgrades(s.db)
 }
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/antonite/ltd-meta-server/config"
+	dynamicdata "github.com/antonite/ltd-meta-server/dynamic-data"
+	"github.com/antonite/ltd-meta-server/tier"
+	"github.com/antonite/ltd-meta-server/util"
+)
+
+const defaultTierBracket = "all"
+
+// GenerateTiers builds and stores a tier list for every configured wave range
+// and bracket from the latest version's hold tables
+func (s *Server) GenerateTiers(ctx context.Context) (int, error) {
+	start := time.Now()
+	version, err := s.latestVersion()
+	if err != nil {
+		return 0, err
+	}
+	if version == "" {
+		return 0, nil
+	}
+	tables := s.tables()
+
+	// unit -> wave -> bracket
+	summaries := make(map[string]map[int]map[string]*dynamicdata.UnitWaveSummary)
+	for _, u := range s.allUnits().Units {
+		for wave := 1; wave <= util.Waves; wave++ {
+			if ctx.Err() != nil {
+				return 0, ctx.Err()
+			}
+			if !tables[util.GenerateUnitTableName(u.UnitID, wave)+"_holds"] {
+				continue
+			}
+			summary, err := dynamicdata.GetUnitWaveSummary(s.db, u.UnitID, wave, version)
+			if err != nil {
+				return 0, err
+			}
+			if _, ok := summaries[u.UnitID]; !ok {
+				summaries[u.UnitID] = make(map[int]map[string]*dynamicdata.UnitWaveSummary)
+			}
+			summaries[u.UnitID][wave] = summary
+		}
+	}
+
+	weights := tierWeights(s.cfg.Tiers)
+	saved := 0
+	for _, r := range s.cfg.Tiers.WaveRanges {
+		from, to, err := config.ParseWaveRange(r)
+		if err != nil {
+			return saved, err
+		}
+		for _, b := range dynamicdata.Brackets {
+			ranged := make(map[string]*dynamicdata.UnitWaveSummary)
+			for u, waves := range summaries {
+				sum := &dynamicdata.UnitWaveSummary{}
+				for wave := from; wave <= to; wave++ {
+					if ws, ok := waves[wave]; ok {
+						sum.Add(ws[b.Name])
+					}
+				}
+				ranged[u] = sum
+			}
+
+			list := tier.List{
+				Version:   version,
+				WaveFrom:  from,
+				WaveTo:    to,
+				Bracket:   b.Name,
+				Weights:   weights,
+				CreatedAt: time.Now(),
+				Entries:   tier.Build(ranged, weights, s.cfg.Tiers.MinGames),
+			}
+			if _, err := list.Save(s.db); err != nil {
+				return saved, err
+			}
+			saved++
+		}
+	}
+
+	fmt.Printf("generated %d tier lists for %s in %v\n", saved, version, time.Since(start).Round(time.Millisecond))
+	return saved, nil
+}
+
+func tierWeights(cfg config.Tiers) tier.Weights {
+	return tier.Weights{
+		Winrate:  cfg.WinrateWeight,
+		PickRate: cfg.PickRateWeight,
+		HoldRate: cfg.HoldRateWeight,
+		Value:    cfg.ValueWeight,
+	}
+}
+
+// loadTiers builds tier lists on startup when the latest version has none yet
+func (s *Server) loadTiers() {
+	version, err := s.latestVersion()
+	if err != nil || version == "" || len(s.cfg.Tiers.WaveRanges) == 0 {
+		return
+	}
+	from, to, err := config.ParseWaveRange(s.cfg.Tiers.WaveRanges[0])
+	if err != nil {
+		return
+	}
+	list, err := tier.GetLatestList(s.db, version, from, to, defaultTierBracket)
+	if err != nil {
+		fmt.Printf("failed to load tier lists: %v\n", err)
+		return
+	}
+	if list != nil {
+		return
+	}
+	if _, err := s.GenerateTiers(s.ctx); err != nil {
+		fmt.Printf("failed to generate tier lists: %v\n", err)
+	}
+}
+
+// parseTierQuery reads the waves and bracket params, waves defaults to the
+// first configured range
+func (s *Server) parseTierQuery(r *http.Request) (int, int, string, *apiError) {
+	q := r.URL.Query()
+	waves := q.Get("waves")
+	if waves == "" {
+		if len(s.cfg.Tiers.WaveRanges) == 0 {
+			return 0, 0, "", newError(http.StatusBadRequest, codeInvalidRequest, "waves must be set")
+		}
+		waves = s.cfg.Tiers.WaveRanges[0]
+	}
+	from, to, err := config.ParseWaveRange(waves)
+	if err != nil {
+		return 0, 0, "", newError(http.StatusBadRequest, codeInvalidWave, err.Error()).with("waves", waves).with("available", s.cfg.Tiers.WaveRanges)
+	}
+
+	bracket := q.Get("bracket")
+	if bracket == "" {
+		bracket = defaultTierBracket
+	}
+	if _, ok := dynamicdata.FindBracket(bracket); !ok {
+		return 0, 0, "", newError(http.StatusBadRequest, codeInvalidBracket, "unknown bracket").with("bracket", bracket)
+	}
+	return from, to, bracket, nil
+}
+
+func (s *Server) HandleGetTiers(w http.ResponseWriter, r *http.Request) {
+	from, to, bracket, apiErr := s.parseTierQuery(r)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+
+	version := r.URL.Query().Get("version")
+	if version == "" {
+		v, err := s.latestVersion()
+		if err != nil {
+			writeError(w, internalError(err))
+			return
+		}
+		version = v
+	}
+
+	list, err := tier.GetLatestList(s.db, version, from, to, bracket)
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+	if list == nil {
+		writeError(w, newError(http.StatusNotFound, codeNoData, "no tier list for this version, wave range and bracket").with("version", version).with("waves", fmt.Sprintf("%d-%d", from, to)).with("bracket", bracket))
+		return
+	}
+
+	js, err := json.Marshal(list)
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	w.Write(js)
+}
+
+type tierHistory struct {
+	Version   string
+	CreatedAt time.Time
+	// unit id to tier
+	Tiers map[string]string
+}
+
+// HandleGetTierHistory shows how each unit's tier moved between versions
+func (s *Server) HandleGetTierHistory(w http.ResponseWriter, r *http.Request) {
+	from, to, bracket, apiErr := s.parseTierQuery(r)
+	if apiErr != nil {
+		writeError(w, apiErr)
+		return
+	}
+
+	lists, err := tier.GetHistory(s.db, from, to, bracket)
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	unitFilter := r.URL.Query().Get("unit")
+	out := make([]tierHistory, 0, len(lists))
+	for _, l := range lists {
+		h := tierHistory{Version: l.Version, CreatedAt: l.CreatedAt, Tiers: make(map[string]string, len(l.Entries))}
+		for _, e := range l.Entries {
+			if unitFilter != "" && !strings.EqualFold(e.Unit, unitFilter) {
+				continue
+			}
+			h.Tiers[e.Unit] = e.Tier
+		}
+		out = append(out, h)
+	}
+
+	js, err := json.Marshal(out)
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	w.Write(js)
+}
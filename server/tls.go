@@ -0,0 +1,81 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const certCheckInterval = time.Minute
+
+// CertReloader serves the certificate on disk and picks up renewals without a
+// restart, the files are checked at most once per certCheckInterval.
+type CertReloader struct {
+	certPath string
+	keyPath  string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+func NewCertReloader(certPath, keyPath string) (*CertReloader, error) {
+	cr := &CertReloader{certPath: certPath, keyPath: keyPath}
+	if err := cr.load(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+func (cr *CertReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(cr.certPath, cr.keyPath)
+	if err != nil {
+		return err
+	}
+	mod, err := cr.latestModTime()
+	if err != nil {
+		return err
+	}
+	cr.cert = &cert
+	cr.modTime = mod
+	return nil
+}
+
+func (cr *CertReloader) latestModTime() (time.Time, error) {
+	latest := time.Time{}
+	for _, p := range []string{cr.certPath, cr.keyPath} {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return latest, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (cr *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if time.Since(cr.lastCheck) < certCheckInterval {
+		return cr.cert, nil
+	}
+	cr.lastCheck = time.Now()
+
+	mod, err := cr.latestModTime()
+	if err != nil || !mod.After(cr.modTime) {
+		return cr.cert, nil
+	}
+	// keep serving the old certificate if the new pair is half written
+	if err := cr.load(); err != nil {
+		fmt.Printf("failed to reload certificate: %v\n", err)
+		return cr.cert, nil
+	}
+	fmt.Printf("reloaded certificate from %s\n", cr.certPath)
+	return cr.cert, nil
+}
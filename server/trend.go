@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	dynamicdata "github.com/antonite/ltd-meta-server/dynamic-data"
+	"github.com/antonite/ltd-meta-server/util"
+)
+
+type unitTrend struct {
+	Unit    string
+	Version string
+	Waves   []*dynamicdata.WaveTrend
+}
+
+// HandleGetUnitTrend serves /units/{id}/trend, the daily games, pick, hold and
+// win rates of a primary unit within a version
+func (s *Server) HandleGetUnitTrend(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/units/")
+	id := strings.TrimSuffix(rest, "/trend")
+	if id == rest || id == "" {
+		writeError(w, newError(http.StatusNotFound, codeNotFound, "no such endpoint").with("path", r.URL.Path))
+		return
+	}
+
+	units := s.unitMap()
+	if _, ok := units[id]; !ok {
+		// accept the short names hold ids use as well
+		if _, ok := units[id+"_unit_id"]; !ok {
+			writeError(w, newError(http.StatusNotFound, codeUnknownUnit, "unknown unit").with("unit", id))
+			return
+		}
+		id += "_unit_id"
+	}
+
+	q := r.URL.Query()
+	version := q.Get("version")
+	if version == "" {
+		v, err := s.latestVersion()
+		if err != nil {
+			writeError(w, internalError(err))
+			return
+		}
+		version = v
+	}
+
+	waveFilter := 0
+	if wq := q.Get("wave"); wq != "" {
+		wave, err := strconv.Atoi(wq)
+		if err != nil || wave < 1 || wave > util.Waves {
+			writeError(w, newError(http.StatusBadRequest, codeInvalidWave, "wave must be a number between 1 and "+strconv.Itoa(util.Waves)).with("wave", wq))
+			return
+		}
+		waveFilter = wave
+	}
+
+	waves, err := dynamicdata.GetUnitTrend(s.db, version, id)
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	out := unitTrend{Unit: id, Version: version, Waves: []*dynamicdata.WaveTrend{}}
+	for _, wt := range waves {
+		if waveFilter != 0 && wt.Wave != waveFilter {
+			continue
+		}
+		out.Waves = append(out.Waves, wt)
+	}
+
+	js, err := json.Marshal(out)
+	if err != nil {
+		writeError(w, internalError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	w.Write(js)
+}
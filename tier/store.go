@@ -0,0 +1,87 @@
+package tier
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sort"
+
+	dynamicdata "github.com/antonite/ltd-meta-server/dynamic-data"
+)
+
+const saveListQuery = `INSERT INTO tier_list(version, wave_from, wave_to, bracket, weights, entries, created_at) VALUES(?,?,?,?,?,?,?)`
+const getLatestListQuery = `SELECT id, version, wave_from, wave_to, bracket, weights, entries, created_at FROM tier_list where version = ? and wave_from = ? and wave_to = ? and bracket = ? ORDER BY id DESC LIMIT 1`
+const getHistoryQuery = `SELECT id, version, wave_from, wave_to, bracket, weights, entries, created_at FROM tier_list where id in (SELECT max(id) FROM tier_list where wave_from = ? and wave_to = ? and bracket = ? GROUP BY version) ORDER BY id`
+
+func (l *List) Save(db *sql.DB) (int, error) {
+	weights, err := json.Marshal(l.Weights)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := json.Marshal(l.Entries)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := db.Exec(saveListQuery, l.Version, l.WaveFrom, l.WaveTo, l.Bracket, string(weights), string(entries), l.CreatedAt.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := resp.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	l.ID = int(id)
+	return l.ID, nil
+}
+
+// GetLatestList returns nil when no list was built for the version, range and
+// bracket
+func GetLatestList(db *sql.DB, version string, from, to int, bracket string) (*List, error) {
+	lists, err := queryLists(db, getLatestListQuery, version, from, to, bracket)
+	if err != nil || len(lists) == 0 {
+		return nil, err
+	}
+	return lists[0], nil
+}
+
+// GetHistory returns the newest list of every version for the range and
+// bracket, oldest version first
+// GetHistory returns the newest list of every version, oldest version first
+func GetHistory(db *sql.DB, from, to int, bracket string) ([]*List, error) {
+	lists, err := queryLists(db, getHistoryQuery, from, to, bracket)
+	if err != nil {
+		return nil, err
+	}
+	// ids follow generation order, which a backfilled older version breaks
+	sort.SliceStable(lists, func(i, j int) bool {
+		return dynamicdata.CompareVersions(lists[i].Version, lists[j].Version) < 0
+	})
+	return lists, nil
+}
+
+func queryLists(db *sql.DB, q string, args ...interface{}) ([]*List, error) {
+	rows, err := db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []*List{}
+	for rows.Next() {
+		var l List
+		var weights, entries string
+		if err := rows.Scan(&l.ID, &l.Version, &l.WaveFrom, &l.WaveTo, &l.Bracket, &weights, &entries, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(weights), &l.Weights); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(entries), &l.Entries); err != nil {
+			return nil, err
+		}
+		lists = append(lists, &l)
+	}
+
+	return lists, rows.Err()
+}
@@ -0,0 +1,132 @@
+package tier
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	dynamicdata "github.com/antonite/ltd-meta-server/dynamic-data"
+	"github.com/antonite/ltd-meta-server/util"
+)
+
+type Weights struct {
+	Winrate  float64
+	PickRate float64
+	HoldRate float64
+	Value    float64
+}
+
+// Cutoffs assign tiers by rank, each share is cumulative from the top
+var Cutoffs = []struct {
+	Tier  string
+	Share float64
+}{
+	{"S", 0.1},
+	{"A", 0.3},
+	{"B", 0.6},
+	{"C", 0.85},
+	{"D", 1},
+}
+
+type Entry struct {
+	Unit         string
+	Tier         string
+	Score        float64
+	Games        int
+	Winrate      float64
+	PickRate     float64
+	HoldRate     float64
+	AverageValue int
+	// hold rate relative to how much value the board costs compared to the
+	// average board in the wave range
+	ValueEfficiency float64
+}
+
+type List struct {
+	ID        int
+	Version   string
+	WaveFrom  int
+	WaveTo    int
+	Bracket   string
+	Weights   Weights
+	CreatedAt time.Time
+	Entries   []Entry
+}
+
+// Build scores every unit with at least minGames in the range. Summaries must
+// already be added up over the waves of the range. Each stat is scaled to 0-1
+// across the eligible units before weighing so the weights stay comparable.
+func Build(summaries map[string]*dynamicdata.UnitWaveSummary, weights Weights, minGames int) []Entry {
+	total := &dynamicdata.UnitWaveSummary{}
+	for _, s := range summaries {
+		total.Add(s)
+	}
+	if total.Games == 0 {
+		return []Entry{}
+	}
+	rangeValue := float64(total.Value) / float64(total.Games)
+
+	entries := []Entry{}
+	for u, s := range summaries {
+		if s.Games < minGames {
+			continue
+		}
+		e := Entry{
+			Unit:         u,
+			Games:        s.Games,
+			Winrate:      util.Percent(s.Won, s.Games),
+			PickRate:     util.Percent(s.Games, total.Games),
+			HoldRate:     util.Percent(s.Held, s.Sends),
+			AverageValue: s.Value / s.Games,
+		}
+		if e.AverageValue > 0 && rangeValue > 0 {
+			e.ValueEfficiency = math.Round(e.HoldRate/(float64(e.AverageValue)/rangeValue)*10) / 10
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) == 0 {
+		return entries
+	}
+
+	winrate := scaler(entries, func(e Entry) float64 { return e.Winrate })
+	pickRate := scaler(entries, func(e Entry) float64 { return e.PickRate })
+	holdRate := scaler(entries, func(e Entry) float64 { return e.HoldRate })
+	value := scaler(entries, func(e Entry) float64 { return e.ValueEfficiency })
+	sum := weights.Winrate + weights.PickRate + weights.HoldRate + weights.Value
+	for i := range entries {
+		e := &entries[i]
+		score := weights.Winrate*winrate(e.Winrate) + weights.PickRate*pickRate(e.PickRate) + weights.HoldRate*holdRate(e.HoldRate) + weights.Value*value(e.ValueEfficiency)
+		e.Score = math.Round(score/sum*1000) / 1000
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Score != entries[j].Score {
+			return entries[i].Score > entries[j].Score
+		}
+		return entries[i].Unit < entries[j].Unit
+	})
+	c := 0
+	for i := range entries {
+		for float64(i+1) > Cutoffs[c].Share*float64(len(entries)) && c < len(Cutoffs)-1 {
+			c++
+		}
+		entries[i].Tier = Cutoffs[c].Tier
+	}
+
+	return entries
+}
+
+// scaler maps a stat onto 0-1 between its lowest and highest value
+func scaler(entries []Entry, stat func(Entry) float64) func(float64) float64 {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, e := range entries {
+		lo = math.Min(lo, stat(e))
+		hi = math.Max(hi, stat(e))
+	}
+	return func(v float64) float64 {
+		if hi == lo {
+			return 0.5
+		}
+		return (v - lo) / (hi - lo)
+	}
+}
@@ -10,12 +10,13 @@ type Unit struct {
 	TotalValue int
 	Usable     bool
 	Version    string
+	Legion     string
 }
 
 func GetAll(db *sql.DB) (map[string]*Unit, error) {
 	units := make(map[string]*Unit)
 
-	rows, err := db.Query(`SELECT id, unit_id, name, total_value, usable, icon_path, version FROM unit`)
+	rows, err := db.Query(`SELECT id, unit_id, name, total_value, usable, icon_path, version, legion FROM unit`)
 	if err != nil {
 		return units, err
 	}
@@ -23,7 +24,7 @@ func GetAll(db *sql.DB) (map[string]*Unit, error) {
 
 	for rows.Next() {
 		var aunit Unit
-		err = rows.Scan(&aunit.ID, &aunit.UnitID, &aunit.Name, &aunit.TotalValue, &aunit.Usable, &aunit.IconPath, &aunit.Version)
+		err = rows.Scan(&aunit.ID, &aunit.UnitID, &aunit.Name, &aunit.TotalValue, &aunit.Usable, &aunit.IconPath, &aunit.Version, &aunit.Legion)
 		units[aunit.UnitID] = &aunit
 	}
 
@@ -37,13 +38,39 @@ func (unit *Unit) Save(db *sql.DB) error {
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.Prepare("INSERT INTO unit(unit_id, name, icon_path, total_value, usable, version) VALUES(?,?,?,?,?,?)")
+	stmt, err := tx.Prepare("INSERT INTO unit(unit_id, name, icon_path, total_value, usable, version, legion) VALUES(?,?,?,?,?,?,?)")
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(unit.UnitID, unit.Name, unit.IconPath, unit.TotalValue, unit.Usable, unit.Version)
+	_, err = stmt.Exec(unit.UnitID, unit.Name, unit.IconPath, unit.TotalValue, unit.Usable, unit.Version, unit.Legion)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	return err
+}
+
+func (unit *Unit) UpdateLegion(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("UPDATE unit SET legion = ? where id = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(unit.Legion, unit.ID)
 	if err != nil {
 		return err
 	}
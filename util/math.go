@@ -1,5 +1,7 @@
 package util
 
+import "math"
+
 func Min(a, b int) int {
 	if a < b {
 		return a
@@ -7,3 +9,12 @@ func Min(a, b int) int {
 		return b
 	}
 }
+
+// Percent returns n out of d as a percentage rounded to one decimal, 0 when
+// d is 0
+func Percent(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return math.Round(float64(n)/float64(d)*1000) / 10
+}